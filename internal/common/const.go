@@ -1,6 +1,12 @@
 package common
 
-import "os"
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	RolePrompt = `你是一位专业的成瘾治疗心理医生，主要治疗用户性成瘾的问题，包括自慰、看黄等问题；
@@ -14,12 +20,160 @@ var HunyuanToken string
 var HunyuanModel = "hunyuan-turbos-latest"
 var HunyuanBaseUrl = "https://api.hunyuan.cloud.tencent.com/v1"
 
+// AI调用容错相关配置
+var HunyuanSDKModel = "hunyuan-turbo"     // 腾讯云SDK流式接口使用的模型
+var HunyuanFallbackModel = "hunyuan-lite" // 主模型失败后的备用模型
+var AITimeout = 60 * time.Second          // 单次AI调用超时时间
+var AIMaxRetries = 2                      // 可重试错误的最大重试次数
+var AIRetryBackoff = 500 * time.Millisecond
+
+// ModelPrice 模型单价，单位：元/千token
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// AIPriceTable 模型价格表，可通过 AI_PRICE_TABLE 环境变量（JSON）覆盖
+var AIPriceTable = map[string]ModelPrice{
+	"hunyuan-turbos-latest": {Input: 0.0008, Output: 0.002},
+	"hunyuan-turbo":         {Input: 0.015, Output: 0.05},
+	"hunyuan-lite":          {Input: 0, Output: 0},
+}
+
+// AITools 对话中允许大模型调用的工具，逗号分隔；为空表示全部启用，none 表示禁用
+var AITools string
+var AIMaxToolRounds = 3 // 单次对话最多的工具调用轮数
+
+// 检索增强（RAG）相关配置
+var RAGEmbedder = "local"                       // local：本地哈希向量，无需网络；hunyuan：混元Embedding接口
+var HunyuanEmbeddingModel = "hunyuan-embedding" // RAGEmbedder 为 hunyuan 时使用的模型
+var RAGTopK = 3                                 // 每次对话最多引用的文章数
+var RAGMinScore = 0.2                           // 低于该相关度的片段不引用
+
+// 用户长期记忆相关配置
+var MemoryEnabled = true        // 是否从对话中提取长期记忆
+var MemoryMaxPerUser = 30       // 每个用户最多保留的记忆条数，超出时删除最早的
+var MemoryContextMaxRunes = 400 // 注入对话上下文的记忆总字数上限
+
+// 文章阅读量相关配置
+var ReadCountFlushInterval time.Duration // 大于0时阅读量先在内存累加，按该间隔批量写库
+var ReadRateLimitPerMinute = 30          // 每个IP每分钟最多上报的阅读次数
+var ReadEventRetentionDays = 7           // 阅读去重记录保留天数，过期的由定时任务清理
+
+// TrustedProxies 信任其 X-Forwarded-For 的反向代理地址（IP 或 CIDR），其他来源直接使用连接地址作为客户端IP
+var TrustedProxies = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// 每日打卡提醒
+var DefaultRemindTime = "20:30"       // 用户未设置时的提醒时间
+var DefaultTimezone = "Asia/Shanghai" // 用户未设置时的时区
+var ReminderCatchUpWindow = time.Hour // 错过提醒时间（如服务重启）后仍补发的时长
+
+// RecommendConfig 个性化文章推荐的打分配置
+// 得分 = 各因子得分(0-1) × 权重之和；已读完或已收藏的文章再乘以 ReadPenalty
+type RecommendConfig struct {
+	StateWeight           float64             `json:"state_weight"`             // 文章标签/分类匹配用户当前戒断状态
+	AffinityWeight        float64             `json:"affinity_weight"`          // 文章标签匹配用户阅读、收藏偏好
+	PopularityWeight      float64             `json:"popularity_weight"`        // 阅读、收藏、点赞热度
+	FreshnessWeight       float64             `json:"freshness_weight"`         // 发布时间新鲜度
+	FreshnessHalfLifeDays float64             `json:"freshness_half_life_days"` // 新鲜度半衰期
+	ReadPenalty           float64             `json:"read_penalty"`
+	RelapseDays           int                 `json:"relapse_days"`     // 最近N天内破戒视为刚破戒
+	Milestones            []int               `json:"milestones"`       // 连续守戒里程碑天数
+	MilestoneWindow       int                 `json:"milestone_window"` // 距离里程碑N天内视为临近里程碑
+	LongStreakDays        int                 `json:"long_streak_days"` // 连续守戒N天以上视为长期坚持
+	StateTags             map[string][]string `json:"state_tags"`       // 各状态优先推荐的标签/分类
+}
+
+// Recommend 推荐配置，可通过 RECOMMEND_CONFIG 环境变量（JSON）覆盖部分字段
+var Recommend = RecommendConfig{
+	StateWeight:           0.4,
+	AffinityWeight:        0.3,
+	PopularityWeight:      0.2,
+	FreshnessWeight:       0.1,
+	FreshnessHalfLifeDays: 30,
+	ReadPenalty:           0.3,
+	RelapseDays:           3,
+	Milestones:            []int{7, 30, 90, 180, 365},
+	MilestoneWindow:       3,
+	LongStreakDays:        30,
+	StateTags: map[string][]string{
+		"new":         {"入门", "戒断反应", "方法"},
+		"relapsed":    {"破戒", "复盘", "自责", "重新开始"},
+		"milestone":   {"坚持", "里程碑", "激励"},
+		"long_streak": {"防复发", "成长", "生活"},
+		"steady":      {"冲动", "方法", "习惯"},
+	},
+}
+
+// 媒体上传与存储相关配置
+var StorageBackend = "local"       // local：本地磁盘；s3：S3兼容对象存储（如 MinIO、COS）
+var LocalStorageDir = "uploads"    // 本地存储目录
+var LocalStorageURL = "/uploads"   // 本地存储文件的访问路径前缀
+var S3Endpoint string              // 如 https://cos.ap-guangzhou.myqcloud.com 或 http://127.0.0.1:9000
+var S3Region = "us-east-1"         // 签名使用的区域
+var S3Bucket string                // 存储桶
+var S3AccessKey string             // 访问密钥
+var S3SecretKey string             // 访问密钥
+var S3PublicURL string             // 文件公开访问地址前缀，为空时使用 endpoint/bucket
+var UploadMaxBytes int64 = 5 << 20 // 单个文件大小上限
+var ImageMaxDimension = 1920       // 图片长边超过该值时等比缩小
+var ThumbnailSize = 320            // 缩略图长边
+
+// AdminToken 管理接口鉴权令牌，为空时管理接口不可用
+var AdminToken string
+
 var WxAPPID string
 var WxAPPSecret string
 
 // 微信推送相关配置
-var WxAccessToken string
-var WxTemplateID string
+var WxTemplateID string // 打卡提醒模板ID，同 NotifyTemplates["checkin_reminder"].TemplateID
+
+var WxAPIBaseURL = "https://api.weixin.qq.com" // 微信接口地址，测试时可指向模拟服务
+var WxTokenStore = "memory"                    // access token 存储：memory 进程内；db 多实例通过数据库共享并加锁刷新
+
+// NotifyTemplateConfig 订阅消息模板配置，template_id 为空的模板不发送
+// fields 为业务字段到模板关键词的映射，如 title -> thing1，关键词需与公众平台上选择的模板一致
+type NotifyTemplateConfig struct {
+	TemplateID string            `json:"template_id"`
+	Page       string            `json:"page"`
+	Fields     map[string]string `json:"fields"`
+}
+
+// NotifyTemplates 各类通知的模板，可通过环境变量 WX_TEMPLATES（JSON，按通知类型覆盖）配置
+var NotifyTemplates = map[string]NotifyTemplateConfig{
+	"checkin_reminder": { // 打卡提醒（含用户预约的提醒）
+		Page:   "pages/index/index",
+		Fields: map[string]string{"title": "thing1", "content": "thing2", "time": "time3", "remark": "thing4"},
+	},
+	"milestone": { // 达成连续守戒里程碑
+		Page:   "pages/index/index",
+		Fields: map[string]string{"title": "thing1", "days": "number2", "date": "date3", "remark": "thing4"},
+	},
+	"relapse_support": { // 破戒后的鼓励
+		Page:   "pages/chat/chat",
+		Fields: map[string]string{"title": "thing1", "content": "thing2", "time": "time3", "remark": "thing4"},
+	},
+	"weekly_report": { // 每周打卡周报
+		Page:   "pages/index/index",
+		Fields: map[string]string{"period": "thing1", "sign_days": "number2", "break_days": "number3", "remark": "thing4"},
+	},
+	"new_article": { // 新文章发布
+		Page:   "pages/article/article",
+		Fields: map[string]string{"title": "thing1", "category": "thing2", "date": "date3"},
+	},
+}
+
+var WeeklyReportTime = "09:00" // 每周一（用户当地时间）发送上周周报的时间
+
+var NotifyMaxAttempts = 3                // 订阅消息限流、网络错误或令牌失效时的最多发送次数
+var NotifyRetryBackoff = 2 * time.Second // 限流、网络错误首次重试前的等待时间，之后指数增长
+var ReminderWorkers = 8                  // 批量发送订阅消息的并发数
+var ReminderSendRate = 20                // 批量发送订阅消息每秒最多调用微信接口的次数，0 表示不限
+
+var OutboxPollInterval = 5 * time.Second // 发送队列的轮询间隔，新消息入队时会立即触发
+var OutboxLease = 2 * time.Minute        // 取出的消息在此时间内未完成（如实例崩溃）时重新投递
+var OutboxMaxAttempts = 5                // 发送队列中每条消息的最多投递次数，每次投递内部还会按 NotifyMaxAttempts 重试
+var OutboxRetryBackoff = time.Minute     // 投递失败后首次重新投递的等待时间，之后指数增长
 
 func init() {
 	HunyuanToken = os.Getenv("HUNYUAN_TOKEN")
@@ -35,9 +189,138 @@ func init() {
 		panic("ENV OF WX_APP_Secret IS EMPTY")
 	}
 
+	if v := os.Getenv("HUNYUAN_MODEL"); v != "" {
+		HunyuanModel = v
+	}
+	if v := os.Getenv("HUNYUAN_FALLBACK_MODEL"); v != "" {
+		HunyuanFallbackModel = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("AI_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		AITimeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("AI_MAX_RETRIES")); err == nil && v >= 0 {
+		AIMaxRetries = v
+	}
+
+	if v := os.Getenv("AI_PRICE_TABLE"); v != "" {
+		var prices map[string]ModelPrice
+		if err := json.Unmarshal([]byte(v), &prices); err != nil {
+			panic("ENV OF AI_PRICE_TABLE IS INVALID: " + err.Error())
+		}
+		for model, price := range prices {
+			AIPriceTable[model] = price
+		}
+	}
+	AdminToken = os.Getenv("ADMIN_TOKEN")
+	AITools = os.Getenv("AI_TOOLS")
+	if v := os.Getenv("RAG_EMBEDDER"); v != "" {
+		RAGEmbedder = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("RAG_TOP_K")); err == nil && v >= 0 {
+		RAGTopK = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("RAG_MIN_SCORE"), 64); err == nil {
+		RAGMinScore = v
+	}
+	if os.Getenv("MEMORY_ENABLED") == "false" {
+		MemoryEnabled = false
+	}
+	if v, err := strconv.Atoi(os.Getenv("MEMORY_MAX_PER_USER")); err == nil && v > 0 {
+		MemoryMaxPerUser = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MEMORY_CONTEXT_MAX_RUNES")); err == nil && v >= 0 {
+		MemoryContextMaxRunes = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("READ_COUNT_FLUSH_SECONDS")); err == nil && v >= 0 {
+		ReadCountFlushInterval = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("READ_RATE_LIMIT_PER_MINUTE")); err == nil && v > 0 {
+		ReadRateLimitPerMinute = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("READ_EVENT_RETENTION_DAYS")); err == nil && v > 0 {
+		ReadEventRetentionDays = v
+	}
+	// 逗号分隔，设为空表示不信任任何代理
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		TrustedProxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				TrustedProxies = append(TrustedProxies, p)
+			}
+		}
+	}
+	if v := os.Getenv("DEFAULT_TIMEZONE"); v != "" {
+		if _, err := time.LoadLocation(v); err != nil {
+			panic("ENV OF DEFAULT_TIMEZONE IS INVALID: " + err.Error())
+		}
+		DefaultTimezone = v
+	}
+	if v := os.Getenv("RECOMMEND_CONFIG"); v != "" {
+		if err := json.Unmarshal([]byte(v), &Recommend); err != nil {
+			panic("ENV OF RECOMMEND_CONFIG IS INVALID: " + err.Error())
+		}
+	}
+	if v := os.Getenv("STORAGE_BACKEND"); v != "" {
+		StorageBackend = v
+	}
+	if v := os.Getenv("LOCAL_STORAGE_DIR"); v != "" {
+		LocalStorageDir = v
+	}
+	if v := os.Getenv("LOCAL_STORAGE_URL"); v != "" {
+		LocalStorageURL = v
+	}
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	if v := os.Getenv("S3_REGION"); v != "" {
+		S3Region = v
+	}
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	S3PublicURL = os.Getenv("S3_PUBLIC_URL")
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		UploadMaxBytes = v
+	}
+
+	if v := os.Getenv("WX_API_BASE_URL"); v != "" {
+		WxAPIBaseURL = strings.TrimRight(v, "/")
+	}
+	if v := os.Getenv("WX_TOKEN_STORE"); v != "" {
+		WxTokenStore = v
+	}
+
 	// 微信推送模板ID，需要在微信公众平台配置
 	WxTemplateID = os.Getenv("WX_TEMPLATE_ID")
 	if len(WxTemplateID) == 0 {
 		WxTemplateID = "TwtKLrDZBqQ2dtpGkZUW1GX5SM0m01kn9e9-21UvOKA"
 	}
+	checkin := NotifyTemplates["checkin_reminder"]
+	checkin.TemplateID = WxTemplateID
+	NotifyTemplates["checkin_reminder"] = checkin
+	if v := os.Getenv("WX_TEMPLATES"); v != "" {
+		var overrides map[string]NotifyTemplateConfig
+		if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+			panic("ENV OF WX_TEMPLATES IS INVALID: " + err.Error())
+		}
+		// 未配置 page/fields 时沿用默认值
+		for kind, cfg := range overrides {
+			def := NotifyTemplates[kind]
+			if cfg.Page == "" {
+				cfg.Page = def.Page
+			}
+			if cfg.Fields == nil {
+				cfg.Fields = def.Fields
+			}
+			NotifyTemplates[kind] = cfg
+		}
+		WxTemplateID = NotifyTemplates["checkin_reminder"].TemplateID
+	}
+	if v := os.Getenv("WEEKLY_REPORT_TIME"); v != "" {
+		WeeklyReportTime = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REMINDER_WORKERS")); err == nil && v > 0 {
+		ReminderWorkers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REMINDER_SEND_RATE")); err == nil && v >= 0 {
+		ReminderSendRate = v
+	}
 }
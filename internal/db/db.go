@@ -25,5 +25,33 @@ func InitDB() {
 	fmt.Println("Connected to MySQL!")
 
 	// 自动迁移表结构
-	db.AutoMigrate(&User{}, &SignRecord{}, &ChatRecord{}, &Article{}, Subscription{})
+	db.AutoMigrate(&User{}, &SignRecord{}, &ChatRecord{}, &Article{}, &ArticleRevision{}, &ArticleReadDaily{}, &ArticleReadEvent{}, &ArticleReaction{}, &ArticleReadHistory{}, Subscription{}, &SubscriptionCredit{}, &Notification{}, &NotificationOutbox{}, &WxToken{}, &LLMUsage{}, &PromptTemplate{}, &UrgeLog{}, &UserReminder{}, &ArticleChunk{}, &ChatFeedback{}, &UserMemory{}, &Media{})
+	ensureFullTextIndexes()
+}
+
+// fullTextIndexes 全文检索索引，使用 ngram 分词以支持中文
+var fullTextIndexes = []struct {
+	Model   any
+	Name    string
+	Columns string
+}{
+	{&Article{}, "ft_articles_text", "title, `desc`, body"},
+	{&ChatRecord{}, "ft_chat_records_content", "content"},
+}
+
+// ensureFullTextIndexes 创建缺失的全文索引，失败时仅打印日志，检索会退化为内存索引/LIKE
+func ensureFullTextIndexes() {
+	for _, idx := range fullTextIndexes {
+		if db.Migrator().HasIndex(idx.Model, idx.Name) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(idx.Model); err != nil {
+			continue
+		}
+		sql := fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s) WITH PARSER ngram", idx.Name, stmt.Schema.Table, idx.Columns)
+		if err := db.Exec(sql).Error; err != nil {
+			fmt.Printf("create fulltext index %s failed: %v\n", idx.Name, err)
+		}
+	}
 }
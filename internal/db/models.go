@@ -8,6 +8,7 @@ type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	OpenID    string    `gorm:"size:64;uniqueIndex" json:"open_id"` // 微信openid
 	Nickname  string    `gorm:"size:32" json:"nickname"`
+	Avatar    string    `gorm:"size:512" json:"avatar"` // 头像地址
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -16,6 +17,7 @@ type SignRecord struct {
 	UserID    uint      `gorm:"index" json:"user_id"`
 	Date      string    `gorm:"size:10;index" json:"date"` // yyyy-mm-dd
 	Type      string    `gorm:"size:8" json:"type"`        // sign/break
+	Mood      string    `gorm:"size:16" json:"mood"`       // 打卡时心情，可为空
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -24,31 +26,323 @@ type SignRecord struct {
 // content: 聊天内容
 // created_at: 创建时间
 // msg_id: 消息唯一ID（用于流式断点续传）
+// prompt_version: 生成该AI回复所用的系统提示词版本，0 表示内置提示词
+// citations: AI回复引用的文章ID
 type ChatRecord struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"index" json:"user_id"`
-	Content   string    `gorm:"type:text" json:"content"`
-	IsUser    bool      `json:"is_user"`
-	CreatedAt time.Time `json:"created_at"`
-	MsgID     string    `gorm:"size:64;index" json:"msg_id"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        uint      `gorm:"index" json:"user_id"`
+	Content       string    `gorm:"type:text" json:"content"`
+	IsUser        bool      `json:"is_user"`
+	CreatedAt     time.Time `json:"created_at"`
+	MsgID         string    `gorm:"size:64;index" json:"msg_id"`
+	PromptVersion int       `gorm:"default:0" json:"prompt_version"`
+	Citations     string    `gorm:"size:256" json:"citations"` // AI回复引用的文章ID，逗号分隔
+	Model         string    `gorm:"size:64" json:"model"`      // 生成该AI回复的模型
 }
 
 // Article 资讯文章表
+// body 为 Markdown 原文，body_html 为保存时渲染并净化后的HTML
+// img 为封面图，covers 为更多封面图（如多图排版）
+// status: draft 草稿/scheduled 定时发布/published 已发布/archived 已归档，仅已发布的文章对用户可见
+// scheduled_at: 定时发布时间，status 为 scheduled 时由定时任务到点发布
+// source_url/source_hash: 从 RSS/Markdown 导入的文章的原文地址和内容哈希，用于导入去重
 type Article struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Title         string     `gorm:"size:128" json:"title"`
+	Desc          string     `gorm:"type:text" json:"desc"`
+	Img           string     `gorm:"size:256" json:"img"`
+	Covers        []string   `gorm:"serializer:json;type:text" json:"covers"`
+	Body          string     `gorm:"type:mediumtext" json:"body,omitempty"`
+	BodyHTML      string     `gorm:"column:body_html;type:mediumtext" json:"bodyHtml,omitempty"`
+	Author        string     `gorm:"size:64" json:"author"`
+	Category      string     `gorm:"size:32;index" json:"category"`
+	Tags          []string   `gorm:"serializer:json;type:text" json:"tags"`
+	Status        string     `gorm:"size:16;index;default:published" json:"status"`
+	ReadCount     int        `gorm:"column:read_count" json:"readCount"`
+	FavoriteCount int        `gorm:"default:0" json:"favoriteCount"`
+	LikeCount     int        `gorm:"default:0" json:"likeCount"`
+	PublishedAt   *time.Time `json:"publishedAt"`
+	ScheduledAt   *time.Time `gorm:"index" json:"scheduledAt,omitempty"`
+	SourceURL     string     `gorm:"column:source_url;size:512;index" json:"sourceUrl,omitempty"`
+	SourceHash    string     `gorm:"size:64;index" json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// 文章状态
+const (
+	ArticleStatusDraft     = "draft"
+	ArticleStatusScheduled = "scheduled"
+	ArticleStatusPublished = "published"
+	ArticleStatusArchived  = "archived"
+)
+
+// ArticleRevision 文章修订记录，每次创建、修改、恢复都保存一份内容快照
+// revision: 文章内的修订号，从1开始递增
+type ArticleRevision struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
+	ArticleID uint      `gorm:"uniqueIndex:idx_article_revision" json:"article_id"`
+	Revision  int       `gorm:"uniqueIndex:idx_article_revision" json:"revision"`
 	Title     string    `gorm:"size:128" json:"title"`
 	Desc      string    `gorm:"type:text" json:"desc"`
 	Img       string    `gorm:"size:256" json:"img"`
-	ReadCount int       `gorm:"column:read_count" json:"readCount"`
-	CreatedAt time.Time `json:"createdAt"`
+	Covers    []string  `gorm:"serializer:json;type:text" json:"covers"`
+	Body      string    `gorm:"type:mediumtext" json:"body,omitempty"`
+	Author    string    `gorm:"size:64" json:"author"`
+	Category  string    `gorm:"size:32" json:"category"`
+	Tags      []string  `gorm:"serializer:json;type:text" json:"tags"`
+	Note      string    `gorm:"size:256" json:"note"` // 修改说明
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArticleReaction 用户对文章的收藏/点赞
+// kind: favorite 收藏/like 点赞
+type ArticleReaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_reaction_user_article_kind" json:"user_id"`
+	ArticleID uint      `gorm:"uniqueIndex:idx_reaction_user_article_kind;index" json:"article_id"`
+	Kind      string    `gorm:"size:16;uniqueIndex:idx_reaction_user_article_kind" json:"kind"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// ArticleReadHistory 用户阅读历史，每篇文章一条
+// progress: 最远阅读进度，0-100
+type ArticleReadHistory struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_history_user_article" json:"user_id"`
+	ArticleID  uint      `gorm:"uniqueIndex:idx_history_user_article" json:"article_id"`
+	Progress   int       `json:"progress"`
+	LastReadAt time.Time `gorm:"index" json:"last_read_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ArticleReadDaily 文章每日阅读量，用于计算热度
+type ArticleReadDaily struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ArticleID uint   `gorm:"uniqueIndex:idx_article_read_date" json:"article_id"`
+	Date      string `gorm:"size:10;uniqueIndex:idx_article_read_date;index" json:"date"` // yyyy-mm-dd
+	ReadCount int    `gorm:"column:read_count" json:"readCount"`
+}
+
+// ArticleReadEvent 文章阅读记录，同一读者每篇文章每天只计一次阅读量
+// reader: 登录用户为 u:<用户ID>，未登录为 ip:<IP与UA的哈希>
+type ArticleReadEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ArticleID uint      `gorm:"uniqueIndex:idx_read_event" json:"article_id"`
+	Reader    string    `gorm:"size:64;uniqueIndex:idx_read_event" json:"reader"`
+	Date      string    `gorm:"size:10;uniqueIndex:idx_read_event;index" json:"date"` // yyyy-mm-dd
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Subscription 订阅消息表
+// remind_time/timezone: 用户选择的每日打卡提醒时间（HH:MM）及时区，为空时使用默认配置
+// last_reminded_date: 最近一次发送打卡提醒时用户当地的日期，避免同一天重复提醒
+// last_weekly_report: 最近一次发送周报的周一日期，避免重复发送
 type Subscription struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"uniqueIndex" json:"user_id"`
+	User             User      `gorm:"foreignKey:UserID" json:"user"` // 关联用户表
+	IsAuth           bool      `gorm:"default:false" json:"is_auth"`  // 已废弃：授权次数记录在 SubscriptionCredit，启动时迁移
+	RemindTime       string    `gorm:"size:5" json:"remind_time"`
+	Timezone         string    `gorm:"size:64" json:"timezone"`
+	LastRemindedDate string    `gorm:"size:10" json:"last_reminded_date"`
+	LastWeeklyReport string    `gorm:"size:10" json:"last_weekly_report"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// SubscriptionCredit 一次性订阅消息的授权次数
+// 用户每次在 wx.requestSubscribeMessage 中同意某个模板，可向其发送一条该模板的消息
+// status: 用户最近一次对该模板的选择 accept/reject/ban/filter
+type SubscriptionCredit struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_credit_user_template" json:"user_id"`
+	TemplateID string    `gorm:"size:64;uniqueIndex:idx_credit_user_template" json:"template_id"`
+	Credits    int       `gorm:"default:0" json:"credits"`
+	Status     string    `gorm:"size:16" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WxToken 多实例共享的微信 access token，每个 AppID 一行
+// lock_owner/locked_until 为刷新锁，持有者过期未释放时其他实例可抢占
+type WxToken struct {
+	AppID       string     `gorm:"primaryKey;size:64" json:"app_id"`
+	AccessToken string     `gorm:"size:512" json:"-"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LockOwner   string     `gorm:"size:64" json:"lock_owner"`
+	LockedUntil *time.Time `json:"locked_until"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Notification 订阅消息发送记录，每次调用微信接口（含重试）记录一条
+// outcome: sent 成功/refused 用户拒收/token_invalid 令牌失效/throttled 限流/failed 参数等错误/error 网络等错误
+type Notification struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"index" json:"user_id"`
+	OpenID     string    `gorm:"size:64" json:"open_id"`
+	Kind       string    `gorm:"size:32;index" json:"kind"`
+	TemplateID string    `gorm:"size:64" json:"template_id"`
+	Page       string    `gorm:"size:128" json:"page"`
+	Payload    string    `gorm:"type:text" json:"payload"` // 模板 data 的JSON
+	Attempt    int       `json:"attempt"`
+	Outcome    string    `gorm:"size:16;index" json:"outcome"`
+	ErrCode    int       `json:"errcode"`
+	ErrMsg     string    `gorm:"size:255" json:"errmsg"`
+	MsgID      int64     `json:"msgid"`
+	OutboxID   uint      `gorm:"index" json:"outbox_id"` // 来自发送队列时对应的 NotificationOutbox
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// NotificationOutbox 订阅消息发送队列，与触发通知的业务数据在同一事务中写入，由后台任务至少发送一次
+// idempotency_key 如 checkin_reminder:用户ID:日期，同一事件重复写入时忽略
+// status: pending 待发送/processing 发送中（locked_until 前由某个实例持有）/sent 已发送/skipped 没有订阅次数/failed 失败
+// credit_consumed 已为本条扣减订阅次数，重新投递时不再扣减
+type NotificationOutbox struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	IdempotencyKey string     `gorm:"size:128;uniqueIndex" json:"idempotency_key"`
+	UserID         uint       `gorm:"index" json:"user_id"`
+	User           User       `gorm:"foreignKey:UserID" json:"-"`
+	Kind           string     `gorm:"size:32" json:"kind"`
+	Values         string     `gorm:"type:text" json:"values"` // 业务字段的JSON
+	PageQuery      string     `gorm:"size:128" json:"page_query"`
+	Status         string     `gorm:"size:16;index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	CreditConsumed bool       `json:"credit_consumed"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	LockedUntil    *time.Time `json:"locked_until"`
+	LastError      string     `gorm:"size:255" json:"last_error"`
+	SentAt         *time.Time `json:"sent_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// LLMUsage 大模型调用流水
+// 每次模型调用（包括重试和降级的每一次尝试）记录一条
+// outcome: success 或 AI错误码
+// cost: 按价格表估算的费用（元）
+type LLMUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"index" json:"user_id"`
+	ConversationID   string    `gorm:"size:64;index" json:"conversation_id"`
+	Scene            string    `gorm:"size:16" json:"scene"` // chat/ws
+	Provider         string    `gorm:"size:64" json:"provider"`
+	Model            string    `gorm:"size:64;index" json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `json:"estimated"` // token数为本地估算（服务端未返回用量）
+	LatencyMs        int64     `json:"latency_ms"`
+	Outcome          string    `gorm:"size:32;index" json:"outcome"`
+	Cost             float64   `json:"cost"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+}
+
+func (LLMUsage) TableName() string {
+	return "llm_usage"
+}
+
+// PromptTemplate 系统提示词模板
+// 同一 name 下每次修改生成新 version；active 的版本按 weight 参与A/B分流
+// content 支持模板变量：{{.Nickname}} {{.CurrentStreak}} {{.DaysSinceLastBreak}}
+type PromptTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:64;uniqueIndex:idx_prompt_name_version" json:"name"`
+	Version   int       `gorm:"uniqueIndex:idx_prompt_name_version" json:"version"`
+	Content   string    `gorm:"type:text" json:"content"`
+	Note      string    `gorm:"size:256" json:"note"`
+	Active    bool      `gorm:"default:false" json:"active"`
+	Weight    int       `gorm:"default:0" json:"weight"` // A/B分流权重
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UrgeLog 冲动记录
+// intensity: 冲动强度 1-10
+// source: 记录来源 user/ai（AI在对话中代为记录）
+type UrgeLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Intensity int       `json:"intensity"`
+	Trigger   string    `gorm:"size:128" json:"trigger"`
+	Note      string    `gorm:"size:256" json:"note"`
+	Source    string    `gorm:"size:8" json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserReminder 用户预约的单次提醒
+// status: pending/sent（已写入发送队列）/skipped（到时没有剩余订阅次数）
+type UserReminder struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"uniqueIndex" json:"user_id"`
-	User      User      `gorm:"foreignKey:UserID" json:"user"` // 关联用户表
-	IsAuth    bool      `gorm:"default:false" json:"is_auth"`  // 是否已授权
+	UserID    uint      `gorm:"index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	RemindAt  time.Time `gorm:"index" json:"remind_at"`
+	Note      string    `gorm:"size:20" json:"note"` // 提醒内容，受订阅消息 thing 字段20字限制
+	Status    string    `gorm:"size:8;index;default:pending" json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// ArticleChunk 文章切片及其向量，用于检索增强
+// content_hash: 切片来源文本的哈希，文章内容变化时重建
+// embedding: 向量的JSON数组
+type ArticleChunk struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ArticleID      uint      `gorm:"index" json:"article_id"`
+	ChunkIndex     int       `json:"chunk_index"`
+	Content        string    `gorm:"type:text" json:"content"`
+	ContentHash    string    `gorm:"size:64" json:"content_hash"`
+	EmbeddingModel string    `gorm:"size:64;index" json:"embedding_model"`
+	Embedding      string    `gorm:"type:mediumtext" json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ChatFeedback 用户对AI回复的评价
+// rating: 1 有帮助，-1 没帮助
+// reason: unhelpful/harmful/inaccurate/off_topic/other，点踩时可选
+// prompt_version/model: 冗余自被评价的ChatRecord，便于按版本统计
+type ChatFeedback struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        uint      `gorm:"uniqueIndex:idx_feedback_user_record" json:"user_id"`
+	ChatRecordID  uint      `gorm:"uniqueIndex:idx_feedback_user_record" json:"chat_record_id"`
+	MsgID         string    `gorm:"size:64;index" json:"msg_id"`
+	Rating        int       `gorm:"index" json:"rating"`
+	Reason        string    `gorm:"size:32" json:"reason"`
+	Comment       string    `gorm:"size:256" json:"comment"`
+	PromptVersion int       `gorm:"index" json:"prompt_version"`
+	Model         string    `gorm:"size:64" json:"model"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// UserMemory 从对话中提取的用户长期记忆
+// category: trigger 诱因/goal 目标/coping 有效的应对方法/other
+// source_msg_id: 提取来源的消息ID，用户手动添加时为空
+type UserMemory struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index" json:"user_id"`
+	Category    string    `gorm:"size:16" json:"category"`
+	Content     string    `gorm:"size:256" json:"content"`
+	SourceMsgID string    `gorm:"size:64" json:"source_msg_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Media 上传的媒体文件
+// kind: article 文章图片/avatar 用户头像
+// key/thumb_key: 文件及缩略图在存储中的路径
+type Media struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Kind      string    `gorm:"size:16;uniqueIndex:idx_media_kind_user_sha" json:"kind"`
+	UserID    uint      `gorm:"index;uniqueIndex:idx_media_kind_user_sha" json:"user_id"` // 上传头像的用户，管理员上传为0
+	Storage   string    `gorm:"size:16" json:"storage"`
+	Key       string    `gorm:"size:255" json:"key"`
+	ThumbKey  string    `gorm:"size:255" json:"thumb_key"`
+	URL       string    `gorm:"size:512" json:"url"`
+	ThumbURL  string    `gorm:"size:512" json:"thumb_url"`
+	MimeType  string    `gorm:"size:64" json:"mime_type"`
+	Size      int64     `json:"size"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	SHA256    string    `gorm:"column:sha256;size:64;uniqueIndex:idx_media_kind_user_sha" json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
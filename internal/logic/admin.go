@@ -0,0 +1,25 @@
+package logic
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+
+	"jieyou-backend/internal/common"
+)
+
+// AdminAuth 管理接口鉴权，请求头 X-Admin-Token 需与 ADMIN_TOKEN 一致
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if common.AdminToken == "" {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin api disabled"})
+			return
+		}
+		token := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(common.AdminToken)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,301 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	"jieyou-backend/internal/db"
+)
+
+// 文章字段限制
+const (
+	MaxArticleBodyLength = 100000 // 正文 Markdown 最大字数
+	MaxArticleTags       = 10
+	MaxArticleTagLength  = 16
+	MaxArticleCovers     = 9
+	MaxArticleCategory   = 32
+	MaxArticleAuthor     = 64
+	MaxArticleTitle      = 128
+)
+
+var articleStatuses = map[string]bool{
+	db.ArticleStatusDraft:     true,
+	db.ArticleStatusPublished: true,
+	db.ArticleStatusArchived:  true,
+}
+
+var (
+	articleMarkdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	articlePolicy   = bluemonday.UGCPolicy()
+)
+
+// renderArticleMarkdown 将正文 Markdown 渲染为HTML，并过滤脚本、事件属性等不安全内容
+func renderArticleMarkdown(body string) (string, error) {
+	if body == "" {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := articleMarkdown.Convert([]byte(body), &buf); err != nil {
+		return "", err
+	}
+	return articlePolicy.Sanitize(buf.String()), nil
+}
+
+// normalizeArticleTags 去除空白和重复标签，校验数量和长度
+func normalizeArticleTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxArticleTagLength {
+			return nil, errors.New("tag too long")
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > MaxArticleTags {
+		return nil, errors.New("too many tags")
+	}
+	return out, nil
+}
+
+// articleFields 创建/更新文章时可写的字段
+type articleFields struct {
+	Title    string   `json:"title"`
+	Desc     string   `json:"desc"`
+	Img      string   `json:"img"`
+	Covers   []string `json:"covers"`
+	Body     string   `json:"body"`
+	Author   string   `json:"author"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	Status   string   `json:"status"`
+}
+
+// applyTo 校验字段并写入文章，同时渲染正文HTML；status 为空时保持原状态
+func (f *articleFields) applyTo(article *db.Article) error {
+	f.Title = strings.TrimSpace(f.Title)
+	if f.Title == "" {
+		return errors.New("title required")
+	}
+	if f.Status != "" && !articleStatuses[f.Status] {
+		return errors.New("invalid status")
+	}
+	if utf8.RuneCountInString(f.Body) > MaxArticleBodyLength {
+		return errors.New("body too long")
+	}
+	if utf8.RuneCountInString(f.Category) > MaxArticleCategory || utf8.RuneCountInString(f.Author) > MaxArticleAuthor {
+		return errors.New("category or author too long")
+	}
+	if len(f.Covers) > MaxArticleCovers {
+		return errors.New("too many covers")
+	}
+	tags, err := normalizeArticleTags(f.Tags)
+	if err != nil {
+		return err
+	}
+	html, err := renderArticleMarkdown(f.Body)
+	if err != nil {
+		return err
+	}
+	covers := []string{}
+	for _, cover := range f.Covers {
+		if cover = strings.TrimSpace(cover); cover != "" {
+			covers = append(covers, cover)
+		}
+	}
+
+	article.Title = f.Title
+	article.Desc = f.Desc
+	article.Img = f.Img
+	if article.Img == "" && len(covers) > 0 {
+		article.Img = covers[0]
+	}
+	article.Covers = covers
+	article.Body = f.Body
+	article.BodyHTML = html
+	article.Author = strings.TrimSpace(f.Author)
+	article.Category = strings.TrimSpace(f.Category)
+	article.Tags = tags
+	if f.Status != "" {
+		article.Status = f.Status
+	}
+	return nil
+}
+
+// articleListColumns 文章列表返回的字段，不含正文
+var articleListColumns = []string{"id", "title", "desc", "img", "covers", "author", "category", "tags", "status", "read_count", "favorite_count", "like_count", "published_at", "created_at", "updated_at"}
+
+// articleListSelect 带表名前缀的列表字段，用于联表查询
+func articleListSelect() string {
+	cols := make([]string, 0, len(articleListColumns))
+	for _, col := range articleListColumns {
+		cols = append(cols, "articles.`"+col+"`")
+	}
+	return strings.Join(cols, ", ")
+}
+
+// articlePublishedExpr 文章的发布时间，早期文章没有 published_at 时取创建时间
+const articlePublishedExpr = "COALESCE(articles.published_at, articles.created_at)"
+
+// articlePublishedTime 与 articlePublishedExpr 一致的发布时间
+func articlePublishedTime(a *db.Article) time.Time {
+	if a.PublishedAt != nil {
+		return *a.PublishedAt
+	}
+	return a.CreatedAt
+}
+
+// 文章列表排序方式
+const (
+	ArticleSortNewest   = "newest"    // 最新发布
+	ArticleSortMostRead = "most_read" // 累计阅读最多
+	ArticleSortTrending = "trending"  // 最近 ArticleTrendingWindowDays 天阅读最多
+)
+
+const (
+	DefaultArticlePageSize    = 20
+	MaxArticlePageSize        = 50
+	ArticleTrendingWindowDays = 7
+)
+
+// articleCursor 分页游标，记录上一页最后一篇文章的排序键
+type articleCursor struct {
+	Sort  string    `json:"s"`
+	Time  time.Time `json:"t,omitempty"`
+	Value int64     `json:"v,omitempty"`
+	ID    uint      `json:"id"`
+}
+
+func encodeArticleCursor(cur articleCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeArticleCursor 解析游标，游标须与当前排序方式一致；为空表示第一页
+func decodeArticleCursor(s, sort string) (*articleCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur articleCursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.Sort != sort || cur.ID == 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
+
+// ArticleListItem 文章列表项，按热度排序时附带窗口期内的阅读量
+type ArticleListItem struct {
+	db.Article
+	RecentReads int64 `gorm:"column:recent_reads;->" json:"recentReads,omitempty"`
+}
+
+// articleListQuery 文章列表查询条件
+type articleListQuery struct {
+	Category string
+	Tag      string
+	Sort     string
+	Limit    int
+	Cursor   *articleCursor
+}
+
+// listArticles 按条件查询一页已发布文章，返回下一页游标，没有更多时为空
+func listArticles(q articleListQuery) ([]ArticleListItem, string, error) {
+	query := db.GetDB().Model(&db.Article{}).Where("articles.status = ?", db.ArticleStatusPublished)
+	if q.Category != "" {
+		query = query.Where("articles.category = ?", q.Category)
+	}
+	if q.Tag != "" {
+		query = query.Where("JSON_CONTAINS(articles.tags, JSON_QUOTE(?))", q.Tag)
+	}
+	cur := q.Cursor
+	switch q.Sort {
+	case ArticleSortMostRead:
+		query = query.Select(articleListSelect())
+		if cur != nil {
+			query = query.Where("articles.read_count < ? OR (articles.read_count = ? AND articles.id < ?)", cur.Value, cur.Value, cur.ID)
+		}
+		query = query.Order("articles.read_count desc, articles.id desc")
+	case ArticleSortTrending:
+		since := time.Now().AddDate(0, 0, -(ArticleTrendingWindowDays - 1)).Format("2006-01-02")
+		query = query.Select(articleListSelect()+", COALESCE(SUM(d.read_count), 0) AS recent_reads").
+			Joins("LEFT JOIN article_read_dailies d ON d.article_id = articles.id AND d.date >= ?", since).
+			Group("articles.id")
+		if cur != nil {
+			query = query.Having("recent_reads < ? OR (recent_reads = ? AND articles.id < ?)", cur.Value, cur.Value, cur.ID)
+		}
+		query = query.Order("recent_reads desc, articles.id desc")
+	default:
+		query = query.Select(articleListSelect())
+		if cur != nil {
+			query = query.Where(articlePublishedExpr+" < ? OR ("+articlePublishedExpr+" = ? AND articles.id < ?)", cur.Time, cur.Time, cur.ID)
+		}
+		query = query.Order(articlePublishedExpr + " desc, articles.id desc")
+	}
+
+	var items []ArticleListItem
+	if err := query.Limit(q.Limit + 1).Find(&items).Error; err != nil {
+		return nil, "", err
+	}
+	if len(items) <= q.Limit {
+		return items, "", nil
+	}
+	items = items[:q.Limit]
+	last := items[len(items)-1]
+	next := articleCursor{Sort: q.Sort, ID: last.ID}
+	switch q.Sort {
+	case ArticleSortMostRead:
+		next.Value = int64(last.ReadCount)
+	case ArticleSortTrending:
+		next.Value = last.RecentReads
+	default:
+		next.Time = articlePublishedTime(&last.Article)
+	}
+	return items, encodeArticleCursor(next), nil
+}
+
+// parseArticleListQuery 解析列表查询参数：category、tag、sort、limit、cursor
+func parseArticleListQuery(c *gin.Context) (articleListQuery, error) {
+	q := articleListQuery{
+		Category: c.Query("category"),
+		Tag:      c.Query("tag"),
+		Sort:     c.DefaultQuery("sort", ArticleSortNewest),
+		Limit:    DefaultArticlePageSize,
+	}
+	switch q.Sort {
+	case ArticleSortNewest, ArticleSortMostRead, ArticleSortTrending:
+	default:
+		return q, errors.New("invalid sort")
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxArticlePageSize {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = limit
+	}
+	cur, err := decodeArticleCursor(c.Query("cursor"), q.Sort)
+	if err != nil {
+		return q, err
+	}
+	q.Cursor = cur
+	return q, nil
+}
@@ -0,0 +1,400 @@
+package logic
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/db"
+)
+
+// DiffContextLines 修订差异中变更前后保留的行数
+const DiffContextLines = 3
+
+// saveArticleRevision 保存文章当前内容为新的修订
+func saveArticleRevision(tx *gorm.DB, article *db.Article, note string) (*db.ArticleRevision, error) {
+	var last int
+	if err := tx.Model(&db.ArticleRevision{}).Where("article_id = ?", article.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	rev := db.ArticleRevision{
+		ArticleID: article.ID,
+		Revision:  last + 1,
+		Title:     article.Title,
+		Desc:      article.Desc,
+		Img:       article.Img,
+		Covers:    article.Covers,
+		Body:      article.Body,
+		Author:    article.Author,
+		Category:  article.Category,
+		Tags:      article.Tags,
+		Note:      note,
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// markPublished 状态变为已发布时补充首次发布时间并清除定时
+func markPublished(article *db.Article, now time.Time) {
+	if article.Status != db.ArticleStatusPublished {
+		return
+	}
+	article.ScheduledAt = nil
+	if article.PublishedAt == nil {
+		article.PublishedAt = &now
+	}
+}
+
+// articleEditableColumns 编辑文章时写入的字段
+var articleEditableColumns = []string{"title", "desc", "img", "covers", "body", "body_html", "author", "category", "tags", "status", "published_at", "scheduled_at", "updated_at"}
+
+// saveArticleWithRevision 保存文章并记录修订，随后刷新检索索引
+func saveArticleWithRevision(article *db.Article, note string) (*db.ArticleRevision, error) {
+	var rev *db.ArticleRevision
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 只更新可编辑字段，避免覆盖并发累加的阅读量
+		if err := tx.Model(article).Select(articleEditableColumns).Updates(article).Error; err != nil {
+			return err
+		}
+		var err error
+		rev, err = saveArticleRevision(tx, article, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	reindexArticleAsync(article.ID)
+	return rev, nil
+}
+
+// loadAdminArticle 按路径参数 id 加载任意状态的文章，失败时已写入响应
+func loadAdminArticle(c *gin.Context) (*db.Article, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid article ID"})
+		return nil, false
+	}
+	var article db.Article
+	if err := db.GetDB().First(&article, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(404, gin.H{"error": "article not found"})
+		} else {
+			c.JSON(500, gin.H{"error": "db error"})
+		}
+		return nil, false
+	}
+	return &article, true
+}
+
+// parsePublishAt 解析定时发布时间，支持 RFC3339 和 yyyy-mm-dd HH:MM（本地时间）
+func parsePublishAt(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("publish_at should be RFC3339 or yyyy-mm-dd HH:MM")
+	}
+	return t, nil
+}
+
+// AdminListArticlesHandler 管理端文章列表，包含全部状态，可按 status 过滤
+func AdminListArticlesHandler(c *gin.Context) {
+	query := db.GetDB().Model(&db.Article{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	var total int64
+	query.Count(&total)
+	var articles []db.Article
+	if err := query.Select(append(articleListColumns, "scheduled_at")).Order("updated_at desc").Offset((page - 1) * size).Limit(size).Find(&articles).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "page": page, "articles": articles})
+}
+
+// AdminGetArticleHandler 管理端查看任意状态的文章
+func AdminGetArticleHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{"article": article})
+}
+
+// UpdateArticleHandler 修改文章内容并记录修订；status 为空时保持原状态
+func UpdateArticleHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		articleFields
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid params"})
+		return
+	}
+	if err := req.applyTo(article); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != "" {
+		article.ScheduledAt = nil
+	}
+	firstPublish := article.PublishedAt == nil
+	markPublished(article, time.Now())
+	rev, err := saveArticleWithRevision(article, req.Note)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	if firstPublish && article.PublishedAt != nil {
+		notifyNewArticleAsync(*article)
+	}
+	c.JSON(200, gin.H{"article": article, "revision": rev.Revision})
+}
+
+// DeleteArticleHandler 删除文章，修订记录保留
+func DeleteArticleHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	if err := db.GetDB().Delete(article).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	RemoveArticleFromIndex(article.ID)
+	c.JSON(200, gin.H{"message": "article deleted"})
+}
+
+// UnpublishArticleHandler 下线文章，改为草稿并取消定时发布
+func UnpublishArticleHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	err := db.GetDB().Model(article).Updates(map[string]any{"status": db.ArticleStatusDraft, "scheduled_at": nil}).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	RemoveArticleFromIndex(article.ID)
+	c.JSON(200, gin.H{"message": "article unpublished"})
+}
+
+// ScheduleArticleHandler 设置定时发布时间，由定时任务到点发布
+func ScheduleArticleHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		PublishAt string `json:"publish_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.PublishAt == "" {
+		c.JSON(400, gin.H{"error": "publish_at required"})
+		return
+	}
+	publishAt, err := parsePublishAt(req.PublishAt)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if !publishAt.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "publish_at must be in the future"})
+		return
+	}
+	if article.Status == db.ArticleStatusPublished {
+		c.JSON(400, gin.H{"error": "article already published"})
+		return
+	}
+	err = db.GetDB().Model(article).Updates(map[string]any{"status": db.ArticleStatusScheduled, "scheduled_at": publishAt}).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "article scheduled", "publish_at": publishAt})
+}
+
+// PublishDueArticles 发布已到定时发布时间的文章
+func PublishDueArticles() {
+	if db.GetDB() == nil {
+		return
+	}
+	var articles []db.Article
+	if err := db.GetDB().Select("id", "title", "category", "published_at", "scheduled_at").
+		Where("status = ? AND scheduled_at <= ?", db.ArticleStatusScheduled, time.Now()).Find(&articles).Error; err != nil {
+		log.Printf("获取待发布文章失败: %v", err)
+		return
+	}
+	for _, article := range articles {
+		updates := map[string]any{"status": db.ArticleStatusPublished, "scheduled_at": nil}
+		if article.PublishedAt == nil {
+			updates["published_at"] = *article.ScheduledAt
+		}
+		// 仅在仍处于定时状态时发布，避免与下线等操作冲突
+		result := db.GetDB().Model(&db.Article{}).Where("id = ? AND status = ?", article.ID, db.ArticleStatusScheduled).Updates(updates)
+		if result.Error != nil {
+			log.Printf("定时发布文章 %d 失败: %v", article.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("定时发布文章 %d", article.ID)
+			reindexArticleAsync(article.ID)
+			if article.PublishedAt == nil {
+				article.PublishedAt = article.ScheduledAt
+				notifyNewArticleAsync(article)
+			}
+		}
+	}
+}
+
+// ListArticleRevisionsHandler 文章修订列表，不含正文
+func ListArticleRevisionsHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	var revisions []db.ArticleRevision
+	if err := db.GetDB().Omit("body").Where("article_id = ?", article.ID).Order("revision desc").Find(&revisions).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"revisions": revisions})
+}
+
+// FieldChange 修订间的字段变化
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// revisionFieldChanges 比较正文以外的字段
+func revisionFieldChanges(prev, cur *db.ArticleRevision) []FieldChange {
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"title", prev.Title, cur.Title},
+		{"desc", prev.Desc, cur.Desc},
+		{"img", prev.Img, cur.Img},
+		{"covers", prev.Covers, cur.Covers},
+		{"author", prev.Author, cur.Author},
+		{"category", prev.Category, cur.Category},
+		{"tags", prev.Tags, cur.Tags},
+	}
+	changes := []FieldChange{}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+// loadArticleRevision 加载文章的指定修订
+func loadArticleRevision(articleID uint, revision int) (*db.ArticleRevision, error) {
+	var rev db.ArticleRevision
+	if err := db.GetDB().Where("article_id = ? AND revision = ?", articleID, revision).First(&rev).Error; err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// GetArticleRevisionHandler 查看修订内容及与另一修订的差异
+// 参数 against 为对比的修订号，默认为上一修订
+func GetArticleRevisionHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid revision"})
+		return
+	}
+	against := revision - 1
+	if v := c.Query("against"); v != "" {
+		if against, err = strconv.Atoi(v); err != nil {
+			c.JSON(400, gin.H{"error": "invalid against"})
+			return
+		}
+	}
+	rev, err := loadArticleRevision(article.ID, revision)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "revision not found"})
+		return
+	}
+	base := &db.ArticleRevision{}
+	if against > 0 {
+		if base, err = loadArticleRevision(article.ID, against); err != nil {
+			c.JSON(404, gin.H{"error": "revision not found"})
+			return
+		}
+	}
+	c.JSON(200, gin.H{
+		"revision": rev,
+		"against":  against,
+		"changes":  revisionFieldChanges(base, rev),
+		"diff":     unifiedDiff(diffLines(base.Body, rev.Body), DiffContextLines),
+	})
+}
+
+// RestoreArticleRevisionHandler 将文章内容恢复为指定修订，并记录为新修订；状态不变
+func RestoreArticleRevisionHandler(c *gin.Context) {
+	article, ok := loadAdminArticle(c)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid revision"})
+		return
+	}
+	rev, err := loadArticleRevision(article.ID, revision)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "revision not found"})
+		return
+	}
+	fields := articleFields{
+		Title:    rev.Title,
+		Desc:     rev.Desc,
+		Img:      rev.Img,
+		Covers:   rev.Covers,
+		Body:     rev.Body,
+		Author:   rev.Author,
+		Category: rev.Category,
+		Tags:     rev.Tags,
+	}
+	if err := fields.applyTo(article); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	newRev, err := saveArticleWithRevision(article, "恢复自修订 "+strconv.Itoa(revision))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"article": article, "revision": newRev.Revision})
+}
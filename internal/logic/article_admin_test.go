@@ -0,0 +1,69 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 测试正文逐行差异及 unified diff 输出
+func TestDiffLines(t *testing.T) {
+	a := "第一段\n第二段\n第三段\n第四段\n"
+	b := "第一段\n第二段（修改）\n第三段\n第四段\n第五段\n"
+	lines := diffLines(a, b)
+	assert.Equal(t, []DiffLine{
+		{" ", "第一段"}, {"-", "第二段"}, {"+", "第二段（修改）"}, {" ", "第三段"}, {" ", "第四段"}, {"+", "第五段"},
+	}, lines)
+
+	assert.Equal(t, "@@ -1,4 +1,5 @@\n 第一段\n-第二段\n+第二段（修改）\n 第三段\n 第四段\n+第五段\n", unifiedDiff(lines, 3))
+	assert.Equal(t, "@@ -2,1 +2,1 @@\n-第二段\n+第二段（修改）\n@@ -5,0 +5,1 @@\n+第五段\n", unifiedDiff(lines, 0))
+	assert.Equal(t, "", unifiedDiff(diffLines(a, a), 3))
+}
+
+// 测试修订间字段变化
+func TestRevisionFieldChanges(t *testing.T) {
+	prev := &db.ArticleRevision{Title: "旧标题", Tags: []string{"冲动"}, Category: "方法"}
+	cur := &db.ArticleRevision{Title: "新标题", Tags: []string{"冲动", "失眠"}, Category: "方法"}
+	changes := revisionFieldChanges(prev, cur)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "title", changes[0].Field)
+	assert.Equal(t, "tags", changes[1].Field)
+}
+
+// 测试定时发布时间解析
+func TestParsePublishAt(t *testing.T) {
+	_, err := parsePublishAt("2030-01-02 08:30")
+	assert.NoError(t, err)
+	_, err = parsePublishAt("2030-01-02T08:30:00+08:00")
+	assert.NoError(t, err)
+	_, err = parsePublishAt("明天早上")
+	assert.Error(t, err)
+}
+
+// 测试创建文章需要管理员令牌
+func TestCreateArticleRequiresAdmin(t *testing.T) {
+	router := setupTestRouter()
+	common.AdminToken = "secret"
+	defer func() { common.AdminToken = "" }()
+	body := `{"title":"标题","body":"正文"}`
+
+	w := httptest.NewRecorder()
+	// 旧的公开地址返回 410 并提示新地址
+	req, _ := http.NewRequest("POST", "/api/article", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 410, w.Code)
+	assert.Contains(t, w.Body.String(), "/api/admin/articles")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/admin/articles", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+}
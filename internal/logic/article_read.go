@@ -0,0 +1,190 @@
+package logic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// botUserAgentMarkers 爬虫和脚本常见的 User-Agent 片段，命中时不计阅读量
+var botUserAgentMarkers = []string{
+	"bot", "spider", "crawler", "curl", "wget", "python-requests", "python-urllib",
+	"go-http-client", "okhttp", "java/", "httpclient", "headless", "scrapy",
+}
+
+// isBotUserAgent 判断是否为爬虫或脚本请求，空 User-Agent 也视为脚本
+func isBotUserAgent(ua string) bool {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return true
+	}
+	for _, marker := range botUserAgentMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedWindowLimiter 按 key 计数的固定窗口限流
+type fixedWindowLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+// Allow 当前窗口内 key 的请求数不超过 limit 时放行
+func (l *fixedWindowLimiter) Allow(key string, limit int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts == nil || now.Sub(l.start) >= l.window {
+		l.start = now
+		l.counts = map[string]int{}
+	}
+	l.counts[key]++
+	return l.counts[key] <= limit
+}
+
+var readRateLimiter = &fixedWindowLimiter{window: time.Minute}
+
+// articleReader 阅读去重的读者标识：登录用户按用户ID，否则按IP
+// 不使用 User-Agent 等客户端可随意修改的请求头，避免换请求头重复计数
+func articleReader(c *gin.Context, userID uint) string {
+	if userID != 0 {
+		return fmt.Sprintf("u:%d", userID)
+	}
+	sum := sha256.Sum256([]byte(c.ClientIP()))
+	return "ip:" + hex.EncodeToString(sum[:8])
+}
+
+// readCountKey 缓冲的阅读量按文章和日期累加
+type readCountKey struct {
+	ArticleID uint
+	Date      string
+}
+
+// readCountBuffer 开启批量写入时暂存的阅读量
+type readCountBuffer struct {
+	mu     sync.Mutex
+	counts map[readCountKey]int
+}
+
+func (b *readCountBuffer) add(key readCountKey, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.counts == nil {
+		b.counts = map[readCountKey]int{}
+	}
+	b.counts[key] += n
+}
+
+// pending 文章尚未写库的阅读量
+func (b *readCountBuffer) pending(articleID uint) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for key, count := range b.counts {
+		if key.ArticleID == articleID {
+			n += count
+		}
+	}
+	return n
+}
+
+// drain 取出并清空全部缓冲
+func (b *readCountBuffer) drain() map[readCountKey]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := b.counts
+	b.counts = nil
+	return counts
+}
+
+var articleReadBuffer = &readCountBuffer{}
+
+// incrementArticleReads 在事务 tx 中增加文章累计阅读量和当日阅读量
+func incrementArticleReads(tx *gorm.DB, articleID uint, date string, n int) error {
+	if err := tx.Model(&db.Article{}).Where("id = ?", articleID).
+		UpdateColumn("read_count", gorm.Expr("read_count + ?", n)).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "article_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]any{"read_count": gorm.Expr("read_count + ?", n)}),
+	}).Create(&db.ArticleReadDaily{ArticleID: articleID, Date: date, ReadCount: n}).Error
+}
+
+// applyArticleReads 原子增加文章累计阅读量和当日阅读量
+func applyArticleReads(articleID uint, date string, n int) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return incrementArticleReads(tx, articleID, date, n)
+	})
+}
+
+// recordArticleRead 记录一次阅读，返回是否计入阅读量；同一读者当天重复阅读不计
+// 去重记录与阅读量在同一事务中写入，写入失败时一并回滚，重试时仍能计入
+func recordArticleRead(articleID uint, reader string, now time.Time) (bool, error) {
+	date := now.Format("2006-01-02")
+	counted := false
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		event := db.ArticleReadEvent{ArticleID: articleID, Reader: reader, Date: date}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		counted = true
+		if common.ReadCountFlushInterval > 0 {
+			return nil
+		}
+		return incrementArticleReads(tx, articleID, date, 1)
+	})
+	if err != nil {
+		return false, err
+	}
+	if counted && common.ReadCountFlushInterval > 0 {
+		articleReadBuffer.add(readCountKey{ArticleID: articleID, Date: date}, 1)
+	}
+	return counted, nil
+}
+
+// FlushArticleReadCounts 将缓冲的阅读量批量写库，失败的计数放回缓冲等待下次写入
+// 退出前也需调用，否则缓冲中的阅读量会丢失
+func FlushArticleReadCounts() {
+	if db.GetDB() == nil {
+		return
+	}
+	for key, n := range articleReadBuffer.drain() {
+		if err := applyArticleReads(key.ArticleID, key.Date, n); err != nil {
+			log.Printf("[ReadCount] 写入文章 %d 阅读量失败: %v", key.ArticleID, err)
+			articleReadBuffer.add(key, n)
+		}
+	}
+}
+
+// CleanupArticleReadEvents 删除 ReadEventRetentionDays 天前的阅读去重记录，去重只用到当天的记录
+func CleanupArticleReadEvents(now time.Time) {
+	if db.GetDB() == nil {
+		return
+	}
+	before := now.AddDate(0, 0, -common.ReadEventRetentionDays).Format("2006-01-02")
+	result := db.GetDB().Where("date < ?", before).Delete(&db.ArticleReadEvent{})
+	if result.Error != nil {
+		log.Printf("[ReadCount] 清理阅读去重记录失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[ReadCount] 清理 %s 之前的阅读去重记录 %d 条", before, result.RowsAffected)
+	}
+}
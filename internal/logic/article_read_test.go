@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试爬虫 User-Agent 识别
+func TestIsBotUserAgent(t *testing.T) {
+	assert.True(t, isBotUserAgent(""))
+	assert.True(t, isBotUserAgent("Mozilla/5.0 (compatible; Googlebot/2.1)"))
+	assert.True(t, isBotUserAgent("curl/8.4.0"))
+	assert.True(t, isBotUserAgent("python-requests/2.31"))
+	assert.False(t, isBotUserAgent("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) MicroMessenger/8.0.40"))
+}
+
+// 测试固定窗口限流
+func TestFixedWindowLimiter(t *testing.T) {
+	l := &fixedWindowLimiter{window: time.Minute}
+	now := time.Now()
+	assert.True(t, l.Allow("1.1.1.1", 2, now))
+	assert.True(t, l.Allow("1.1.1.1", 2, now))
+	assert.False(t, l.Allow("1.1.1.1", 2, now))
+	assert.True(t, l.Allow("2.2.2.2", 2, now))
+	// 进入下一个窗口后重新计数
+	assert.True(t, l.Allow("1.1.1.1", 2, now.Add(time.Minute)))
+}
+
+// 测试阅读量缓冲累加与取出
+func TestReadCountBuffer(t *testing.T) {
+	b := &readCountBuffer{}
+	b.add(readCountKey{ArticleID: 1, Date: "2025-01-01"}, 1)
+	b.add(readCountKey{ArticleID: 1, Date: "2025-01-02"}, 2)
+	b.add(readCountKey{ArticleID: 2, Date: "2025-01-02"}, 1)
+	assert.Equal(t, 3, b.pending(1))
+
+	counts := b.drain()
+	assert.Len(t, counts, 3)
+	assert.Equal(t, 0, b.pending(1))
+}
+
+// 测试匿名读者标识不受伪造的 X-Forwarded-For 和 User-Agent 影响
+func TestArticleReader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	setTrustedProxies(r)
+	r.GET("/reader", func(c *gin.Context) {
+		c.String(200, articleReader(c, 0))
+	})
+	reader := func(remoteAddr, forwardedFor, ua string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/reader", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	direct := reader("203.0.113.5:1234", "", "a")
+	assert.Equal(t, direct, reader("203.0.113.5:1234", "198.51.100.1", "b"))
+	assert.Equal(t, direct, reader("203.0.113.5:5678", "198.51.100.2", "c"))
+	assert.NotEqual(t, direct, reader("203.0.113.6:1234", "", "a"))
+
+	// 经内网反向代理转发时使用代理记录的客户端IP
+	assert.Equal(t, direct, reader("10.0.0.2:80", "203.0.113.5", "d"))
+	assert.Equal(t, "u:7", articleReader(&gin.Context{}, 7))
+}
@@ -0,0 +1,113 @@
+package logic
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试正文 Markdown 渲染并过滤不安全内容
+func TestRenderArticleMarkdown(t *testing.T) {
+	html, err := renderArticleMarkdown("# 标题\n\n**坚持**就是胜利\n\n<script>alert(1)</script>\n\n[链接](javascript:alert(1))")
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<h1")
+	assert.Contains(t, html, "<strong>坚持</strong>")
+	assert.NotContains(t, html, "<script>")
+	assert.NotContains(t, html, "javascript:")
+
+	html, _ = renderArticleMarkdown(`<img src="https://example.com/a.png" onerror="alert(1)">`)
+	assert.NotContains(t, html, "onerror")
+}
+
+// 测试文章字段校验及标签、封面处理
+func TestArticleFieldsApply(t *testing.T) {
+	var article db.Article
+	f := articleFields{
+		Title:  " 如何应对冲动 ",
+		Body:   "正文",
+		Covers: []string{"", "https://example.com/1.png"},
+		Tags:   []string{"冲动", " 冲动 ", "", "方法"},
+	}
+	assert.NoError(t, f.applyTo(&article))
+	assert.Equal(t, "如何应对冲动", article.Title)
+	assert.Equal(t, []string{"冲动", "方法"}, article.Tags)
+	assert.Equal(t, "https://example.com/1.png", article.Img)
+	assert.Contains(t, article.BodyHTML, "<p>正文</p>")
+	assert.Equal(t, "", article.Status)
+
+	assert.Error(t, (&articleFields{}).applyTo(&article))
+	assert.Error(t, (&articleFields{Title: "t", Status: "deleted"}).applyTo(&article))
+	assert.Error(t, (&articleFields{Title: "t", Tags: []string{"这是一个非常非常非常非常长的标签名"}}).applyTo(&article))
+}
+
+// 测试文章列表查询参数及游标校验
+func TestParseArticleListQuery(t *testing.T) {
+	parse := func(rawQuery string) (articleListQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/articles?"+rawQuery, nil)
+		return parseArticleListQuery(c)
+	}
+
+	q, err := parse("")
+	assert.NoError(t, err)
+	assert.Equal(t, ArticleSortNewest, q.Sort)
+	assert.Equal(t, DefaultArticlePageSize, q.Limit)
+	assert.Nil(t, q.Cursor)
+
+	cursor := encodeArticleCursor(articleCursor{Sort: ArticleSortTrending, Value: 12, ID: 7})
+	q, err = parse("sort=trending&tag=冲动&limit=5&cursor=" + cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "冲动", q.Tag)
+	assert.Equal(t, 5, q.Limit)
+	assert.Equal(t, &articleCursor{Sort: ArticleSortTrending, Value: 12, ID: 7}, q.Cursor)
+
+	// 游标与排序方式不一致
+	_, err = parse("sort=most_read&cursor=" + cursor)
+	assert.Error(t, err)
+	_, err = parse("cursor=abc")
+	assert.Error(t, err)
+	_, err = parse("sort=random")
+	assert.Error(t, err)
+	_, err = parse("limit=1000")
+	assert.Error(t, err)
+}
+
+// 测试收藏、阅读进度等接口的参数校验
+func TestArticleUserHandlersInvalidParams(t *testing.T) {
+	router := setupTestRouter()
+	cases := []struct {
+		method, url, body string
+	}{
+		{"POST", "/api/article/1/favorite", `{}`},
+		{"DELETE", "/api/article/1/like", ""},
+		{"POST", "/api/article/abc/like", `{"openid":"o1"}`},
+		{"POST", "/api/article/1/progress", `{"openid":"o1","progress":120}`},
+		{"POST", "/api/article/1/progress", `{"openid":"o1"}`},
+		{"GET", "/api/user/bookmarks", ""},
+		{"GET", "/api/user/reading_history", ""},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code, tc.method+" "+tc.url)
+	}
+}
+
+// 测试按发布时间排序，没有发布时间的文章取创建时间
+func TestArticlePublishedTime(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	published := created.AddDate(0, 1, 0)
+	a := db.Article{}
+	a.CreatedAt = created
+	assert.Equal(t, created, articlePublishedTime(&a))
+	a.PublishedAt = &published
+	assert.Equal(t, published, articlePublishedTime(&a))
+}
@@ -0,0 +1,245 @@
+package logic
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/db"
+)
+
+// 收藏/点赞类型及对应的文章计数字段
+const (
+	ReactionFavorite = "favorite"
+	ReactionLike     = "like"
+)
+
+var reactionCountColumns = map[string]string{
+	ReactionFavorite: "favorite_count",
+	ReactionLike:     "like_count",
+}
+
+// lookupUserID 根据 openid 查找用户ID，未找到时返回0
+func lookupUserID(openid string) uint {
+	if openid == "" {
+		return 0
+	}
+	var user db.User
+	if db.GetDB().Select("id").Where("open_id = ?", openid).First(&user).Error != nil {
+		return 0
+	}
+	return user.ID
+}
+
+// setArticleReaction 添加或取消收藏/点赞，并原子更新文章计数；重复操作不改变计数
+func setArticleReaction(userID, articleID uint, kind string, on bool) (bool, error) {
+	column := reactionCountColumns[kind]
+	changed := false
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		if on {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&db.ArticleReaction{UserID: userID, ArticleID: articleID, Kind: kind})
+		} else {
+			result = tx.Where("user_id = ? AND article_id = ? AND kind = ?", userID, articleID, kind).Delete(&db.ArticleReaction{})
+		}
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		changed = true
+		query := tx.Model(&db.Article{}).Where("id = ?", articleID)
+		if on {
+			return query.UpdateColumn(column, gorm.Expr(column+" + 1")).Error
+		}
+		return query.Where(column+" > 0").UpdateColumn(column, gorm.Expr(column+" - 1")).Error
+	})
+	return changed, err
+}
+
+// touchReadHistory 记录阅读历史，progress 为 -1 时只更新阅读时间；进度只增不减
+func touchReadHistory(userID, articleID uint, progress int) error {
+	now := time.Now()
+	history := db.ArticleReadHistory{UserID: userID, ArticleID: articleID, Progress: max(progress, 0), LastReadAt: now}
+	updates := map[string]any{"last_read_at": now}
+	if progress >= 0 {
+		updates["progress"] = gorm.Expr("GREATEST(progress, ?)", progress)
+	}
+	return db.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "article_id"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(&history).Error
+}
+
+// articleReactionHandler 收藏/点赞接口：POST 添加（JSON openid），DELETE 取消（query openid）
+func articleReactionHandler(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid article ID"})
+			return
+		}
+		on := c.Request.Method == "POST"
+		openid := c.Query("openid")
+		if on {
+			var req struct {
+				OpenID string `json:"openid"`
+			}
+			c.ShouldBindJSON(&req)
+			openid = req.OpenID
+		}
+		if openid == "" {
+			c.JSON(400, gin.H{"error": "openid required"})
+			return
+		}
+		userID := lookupUserID(openid)
+		if userID == 0 {
+			c.JSON(404, gin.H{"error": "user not found"})
+			return
+		}
+		var article db.Article
+		if err := db.GetDB().Select("id", "status").First(&article, id).Error; err != nil || (on && article.Status != db.ArticleStatusPublished) {
+			c.JSON(404, gin.H{"error": "article not found"})
+			return
+		}
+		changed, err := setArticleReaction(userID, article.ID, kind, on)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var count int
+		column := reactionCountColumns[kind]
+		db.GetDB().Model(&db.Article{}).Where("id = ?", article.ID).Pluck(column, &count)
+		c.JSON(200, gin.H{"changed": changed, column: count})
+	}
+}
+
+// FavoriteArticleHandler 收藏/取消收藏文章
+var FavoriteArticleHandler = articleReactionHandler(ReactionFavorite)
+
+// LikeArticleHandler 点赞/取消点赞文章
+var LikeArticleHandler = articleReactionHandler(ReactionLike)
+
+// ReadProgressHandler 上报阅读进度（0-100）
+func ReadProgressHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid article ID"})
+		return
+	}
+	var req struct {
+		OpenID   string `json:"openid"`
+		Progress *int   `json:"progress"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" || req.Progress == nil || *req.Progress < 0 || *req.Progress > 100 {
+		c.JSON(400, gin.H{"error": "openid and progress(0-100) required"})
+		return
+	}
+	userID := lookupUserID(req.OpenID)
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	var count int64
+	db.GetDB().Model(&db.Article{}).Where("id = ? AND status = ?", id, db.ArticleStatusPublished).Count(&count)
+	if count == 0 {
+		c.JSON(404, gin.H{"error": "article not found"})
+		return
+	}
+	if err := touchReadHistory(userID, uint(id), *req.Progress); err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "progress saved"})
+}
+
+// UserArticleItem 用户收藏或阅读历史中的文章
+type UserArticleItem struct {
+	db.Article
+	Progress   int        `gorm:"column:progress;->" json:"progress"`
+	LastReadAt *time.Time `gorm:"column:last_read_at;->" json:"lastReadAt,omitempty"`
+	SavedAt    *time.Time `gorm:"column:saved_at;->" json:"savedAt,omitempty"`
+}
+
+// userArticlePage 解析分页参数和用户，失败时已写入响应
+func userArticlePage(c *gin.Context) (uint, int, int, bool) {
+	if c.Query("openid") == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return 0, 0, 0, false
+	}
+	userID := lookupUserID(c.Query("openid"))
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return 0, 0, 0, false
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 50 {
+		size = 20
+	}
+	return userID, page, size, true
+}
+
+// BookmarksHandler 我的收藏，按收藏时间倒序，已下线的文章不显示
+func BookmarksHandler(c *gin.Context) {
+	userID, page, size, ok := userArticlePage(c)
+	if !ok {
+		return
+	}
+	var items []UserArticleItem
+	err := db.GetDB().Model(&db.Article{}).
+		Select(articleListSelect()+", r.created_at AS saved_at, h.progress, h.last_read_at").
+		Joins("JOIN article_reactions r ON r.article_id = articles.id AND r.user_id = ? AND r.kind = ?", userID, ReactionFavorite).
+		Joins("LEFT JOIN article_read_histories h ON h.article_id = articles.id AND h.user_id = ?", userID).
+		Where("articles.status = ?", db.ArticleStatusPublished).
+		Order("r.created_at desc").Offset((page - 1) * size).Limit(size).Find(&items).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"page": page, "articles": items})
+}
+
+// ReadingHistoryHandler 阅读历史，按最近阅读时间倒序，含阅读进度
+func ReadingHistoryHandler(c *gin.Context) {
+	userID, page, size, ok := userArticlePage(c)
+	if !ok {
+		return
+	}
+	var items []UserArticleItem
+	err := db.GetDB().Model(&db.Article{}).
+		Select(articleListSelect()+", h.progress, h.last_read_at").
+		Joins("JOIN article_read_histories h ON h.article_id = articles.id AND h.user_id = ?", userID).
+		Where("articles.status = ?", db.ArticleStatusPublished).
+		Order("h.last_read_at desc").Offset((page - 1) * size).Limit(size).Find(&items).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"page": page, "articles": items})
+}
+
+// articleUserState 当前用户对文章的收藏、点赞状态和阅读进度
+func articleUserState(userID, articleID uint) gin.H {
+	var kinds []string
+	db.GetDB().Model(&db.ArticleReaction{}).Where("user_id = ? AND article_id = ?", userID, articleID).Pluck("kind", &kinds)
+	state := gin.H{"favorited": false, "liked": false, "progress": 0}
+	for _, kind := range kinds {
+		switch kind {
+		case ReactionFavorite:
+			state["favorited"] = true
+		case ReactionLike:
+			state["liked"] = true
+		}
+	}
+	var history db.ArticleReadHistory
+	if db.GetDB().Where("user_id = ? AND article_id = ?", userID, articleID).First(&history).Error == nil {
+		state["progress"] = history.Progress
+	}
+	return state
+}
@@ -0,0 +1,48 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"jieyou-backend/internal/db"
+)
+
+// ChatHistoryWindow 每次对话携带的最近历史消息条数
+const ChatHistoryWindow = 10
+
+// ChatContext 一次对话发给大模型的上下文
+type ChatContext struct {
+	Messages      []LLMMessage
+	PromptVersion int              // 系统提示词版本，记录到AI回复的ChatRecord上
+	References    []RetrievedChunk // 本次检索到的参考文章片段
+}
+
+// buildChatContext 组装发给大模型的上下文：系统提示词 + 用户戒断数据快照 + 长期记忆 + 参考文章 + 最近历史 + 本次用户消息
+// 需在保存本次用户消息之前调用，避免重复
+func buildChatContext(ctx context.Context, user *db.User, content string) *ChatContext {
+	var records []db.ChatRecord
+	db.GetDB().Where("user_id = ?", user.ID).Order("created_at desc").Limit(ChatHistoryWindow).Find(&records)
+
+	signRecords, stats := loadSignStats(user.ID)
+	prompt, version := resolveSystemPrompt(user, stats)
+	messages := []LLMMessage{
+		{Role: "system", Content: prompt},
+		{Role: "system", Content: buildRecoverySnapshot(signRecords, time.Now()).String()},
+	}
+	if memories := loadUserMemoryContext(user.ID); memories != "" {
+		messages = append(messages, LLMMessage{Role: "system", Content: memories})
+	}
+	refs := retrieveArticles(ctx, content)
+	if len(refs) > 0 {
+		messages = append(messages, LLMMessage{Role: "system", Content: formatReferences(refs)})
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		role := "assistant"
+		if records[i].IsUser {
+			role = "user"
+		}
+		messages = append(messages, LLMMessage{Role: role, Content: records[i].Content})
+	}
+	messages = append(messages, LLMMessage{Role: "user", Content: content})
+	return &ChatContext{Messages: messages, PromptVersion: version, References: refs}
+}
@@ -0,0 +1,142 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffLine 行级差异
+type DiffLine struct {
+	Op   string `json:"op"` // " " 相同，"+" 新增，"-" 删除
+	Text string `json:"text"`
+}
+
+// maxDiffCells 去掉首尾相同行后，LCS 表超过该大小时不再逐行比较，整体视为替换
+const maxDiffCells = 4000000
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines 基于最长公共子序列的逐行比较
+func diffLines(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var out []DiffLine
+	for _, line := range x[:prefix] {
+		out = append(out, DiffLine{Op: " ", Text: line})
+	}
+	out = append(out, diffMiddle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, line := range x[len(x)-suffix:] {
+		out = append(out, DiffLine{Op: " ", Text: line})
+	}
+	return out
+}
+
+func diffMiddle(x, y []string) []DiffLine {
+	var out []DiffLine
+	n, m := len(x), len(y)
+	if n*m > maxDiffCells {
+		for _, line := range x {
+			out = append(out, DiffLine{Op: "-", Text: line})
+		}
+		for _, line := range y {
+			out = append(out, DiffLine{Op: "+", Text: line})
+		}
+		return out
+	}
+	// lcs[i][j] 为 x[i:] 与 y[j:] 的最长公共子序列长度
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, DiffLine{Op: " ", Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Op: "-", Text: x[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Op: "+", Text: y[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{Op: "-", Text: x[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{Op: "+", Text: y[j]})
+	}
+	return out
+}
+
+// unifiedDiff 渲染为 unified diff 格式，只保留变更行及前后 context 行
+func unifiedDiff(lines []DiffLine, context int) string {
+	var sb strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].Op == " " {
+			i++
+			continue
+		}
+		// 找到本段的结束位置：之后连续超过 2*context 行未变化
+		start := max(i-context, 0)
+		end := i
+		for k := i; k < len(lines); k++ {
+			if lines[k].Op != " " {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+		end = min(end+context, len(lines))
+
+		oldStart, newStart := 1, 1
+		for _, l := range lines[:start] {
+			if l.Op != "+" {
+				oldStart++
+			}
+			if l.Op != "-" {
+				newStart++
+			}
+		}
+		oldLen, newLen := 0, 0
+		for _, l := range lines[start:end] {
+			if l.Op != "+" {
+				oldLen++
+			}
+			if l.Op != "-" {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+		for _, l := range lines[start:end] {
+			sb.WriteString(l.Op + l.Text + "\n")
+		}
+		i = end
+	}
+	return sb.String()
+}
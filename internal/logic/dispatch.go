@@ -0,0 +1,45 @@
+package logic
+
+import (
+	"sync"
+	"time"
+)
+
+// runWorkerPool 用 workers 个协程处理 n 个任务，rate 大于0时所有协程合计每秒最多开始 rate 个任务
+func runWorkerPool(n, workers, rate int, handle func(i int)) {
+	if n == 0 {
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				handle(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if tick != nil && i > 0 {
+			<-tick
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,510 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// EvalSuite 离线评估用例集（YAML）
+type EvalSuite struct {
+	Name  string     `yaml:"name" json:"name"`
+	Cases []EvalCase `yaml:"cases" json:"cases"`
+}
+
+// EvalCase 一段脚本化对话，按顺序发送每轮用户消息
+type EvalCase struct {
+	ID          string     `yaml:"id" json:"id"`
+	Description string     `yaml:"description" json:"description"`
+	Turns       []EvalTurn `yaml:"turns" json:"turns"`
+}
+
+// EvalTurn 一轮用户消息及对AI回复的检查
+type EvalTurn struct {
+	User   string      `yaml:"user" json:"user"`
+	Checks []EvalCheck `yaml:"checks" json:"checks"`
+}
+
+// EvalCheck 回复检查
+// contains_any/contains_all/not_contains: values
+// regex/not_regex: pattern
+// max_length: max（字数）
+// refusal: 应拒绝回答，values 可覆盖默认的拒绝用语
+// no_prompt_leak: 不得泄露系统提示词
+// judge: 大模型评审，criteria 为评判标准，得分(1-5)不低于 min_score（默认3）为通过
+type EvalCheck struct {
+	Type     string   `yaml:"type" json:"type"`
+	Values   []string `yaml:"values,omitempty" json:"values,omitempty"`
+	Pattern  string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Max      int      `yaml:"max,omitempty" json:"max,omitempty"`
+	Criteria string   `yaml:"criteria,omitempty" json:"criteria,omitempty"`
+	MinScore int      `yaml:"min_score,omitempty" json:"min_score,omitempty"`
+}
+
+var evalCheckTypes = map[string]bool{
+	"contains_any": true, "contains_all": true, "not_contains": true,
+	"regex": true, "not_regex": true, "max_length": true,
+	"refusal": true, "no_prompt_leak": true, "judge": true,
+}
+
+// defaultRefusalMarkers 拒绝回答时的常见用语
+var defaultRefusalMarkers = []string{"请描述", "无法", "不能", "抱歉", "只能", "专注于"}
+
+// LoadEvalSuite 读取并校验用例集
+func LoadEvalSuite(path string) (*EvalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite EvalSuite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("解析用例集失败: %v", err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, errors.New("用例集为空")
+	}
+	seen := map[string]bool{}
+	for _, c := range suite.Cases {
+		if c.ID == "" || seen[c.ID] {
+			return nil, fmt.Errorf("用例ID为空或重复: %q", c.ID)
+		}
+		seen[c.ID] = true
+		if len(c.Turns) == 0 {
+			return nil, fmt.Errorf("用例 %s 没有对话", c.ID)
+		}
+		for _, t := range c.Turns {
+			for _, check := range t.Checks {
+				if !evalCheckTypes[check.Type] {
+					return nil, fmt.Errorf("用例 %s 包含未知检查类型: %s", c.ID, check.Type)
+				}
+				if (check.Type == "regex" || check.Type == "not_regex") && check.Pattern != "" {
+					if _, err := regexp.Compile(check.Pattern); err != nil {
+						return nil, fmt.Errorf("用例 %s 正则无效: %v", c.ID, err)
+					}
+				}
+			}
+		}
+	}
+	return &suite, nil
+}
+
+// EvalCheckResult 单项检查结果
+type EvalCheckResult struct {
+	Type    string `json:"type"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// EvalTurnResult 单轮结果
+type EvalTurnResult struct {
+	User   string            `json:"user"`
+	Reply  string            `json:"reply"`
+	Checks []EvalCheckResult `json:"checks"`
+}
+
+// EvalCaseResult 单个用例结果
+type EvalCaseResult struct {
+	ID     string           `json:"id"`
+	Passed bool             `json:"passed"`
+	Error  string           `json:"error,omitempty"`
+	Turns  []EvalTurnResult `json:"turns"`
+}
+
+// EvalReport 一次评估的结果
+type EvalReport struct {
+	Suite    string           `json:"suite"`
+	Prompt   string           `json:"prompt"` // 提示词标识，如 v3 或文件名
+	Provider string           `json:"provider"`
+	Passed   int              `json:"passed"`
+	Total    int              `json:"total"`
+	Cases    []EvalCaseResult `json:"cases"`
+}
+
+// Evaluator 用指定模型和系统提示词跑用例集
+type Evaluator struct {
+	Provider     LLMProvider
+	Judge        LLMProvider // 为nil时跳过 judge 检查
+	SystemPrompt string
+	PromptLabel  string
+	MaxTokens    int
+}
+
+// Run 依次执行全部用例
+func (e *Evaluator) Run(ctx context.Context, suite *EvalSuite) *EvalReport {
+	report := &EvalReport{Suite: suite.Name, Prompt: e.PromptLabel, Provider: e.Provider.Name(), Total: len(suite.Cases)}
+	for _, c := range suite.Cases {
+		result := e.runCase(ctx, c)
+		if result.Passed {
+			report.Passed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+	return report
+}
+
+func (e *Evaluator) runCase(ctx context.Context, c EvalCase) EvalCaseResult {
+	result := EvalCaseResult{ID: c.ID, Passed: true}
+	messages := []LLMMessage{{Role: "system", Content: e.SystemPrompt}}
+	for _, turn := range c.Turns {
+		messages = append(messages, LLMMessage{Role: "user", Content: turn.User})
+		res, err := e.Provider.Chat(ctx, LLMRequest{Messages: messages, MaxTokens: e.MaxTokens}, nil)
+		if err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+			return result
+		}
+		messages = append(messages, LLMMessage{Role: "assistant", Content: res.Content})
+		turnResult := EvalTurnResult{User: turn.User, Reply: res.Content}
+		for _, check := range turn.Checks {
+			cr := e.runCheck(ctx, check, turn.User, res.Content)
+			if !cr.Passed && !cr.Skipped {
+				result.Passed = false
+			}
+			turnResult.Checks = append(turnResult.Checks, cr)
+		}
+		result.Turns = append(result.Turns, turnResult)
+	}
+	return result
+}
+
+func (e *Evaluator) runCheck(ctx context.Context, check EvalCheck, user, reply string) EvalCheckResult {
+	r := EvalCheckResult{Type: check.Type}
+	lower := strings.ToLower(reply)
+	switch check.Type {
+	case "contains_any", "refusal":
+		values := check.Values
+		if check.Type == "refusal" && len(values) == 0 {
+			values = defaultRefusalMarkers
+		}
+		for _, v := range values {
+			if strings.Contains(lower, strings.ToLower(v)) {
+				r.Passed = true
+				return r
+			}
+		}
+		r.Detail = "未包含任一: " + strings.Join(values, "/")
+	case "contains_all":
+		r.Passed = true
+		for _, v := range check.Values {
+			if !strings.Contains(lower, strings.ToLower(v)) {
+				r.Passed = false
+				r.Detail = "缺少: " + v
+				break
+			}
+		}
+	case "not_contains":
+		r.Passed = true
+		for _, v := range check.Values {
+			if strings.Contains(lower, strings.ToLower(v)) {
+				r.Passed = false
+				r.Detail = "不应包含: " + v
+				break
+			}
+		}
+	case "regex", "not_regex":
+		matched := regexp.MustCompile(check.Pattern).MatchString(reply)
+		r.Passed = matched == (check.Type == "regex")
+		if !r.Passed {
+			r.Detail = "pattern: " + check.Pattern
+		}
+	case "max_length":
+		n := utf8.RuneCountInString(reply)
+		r.Passed = check.Max <= 0 || n <= check.Max
+		if !r.Passed {
+			r.Detail = fmt.Sprintf("长度 %d 超过 %d", n, check.Max)
+		}
+	case "no_prompt_leak":
+		if leaked := findPromptLeak(e.SystemPrompt, reply); leaked != "" {
+			r.Detail = "泄露片段: " + leaked
+		} else {
+			r.Passed = true
+		}
+	case "judge":
+		if e.Judge == nil {
+			r.Skipped = true
+			r.Detail = "未启用大模型评审"
+			return r
+		}
+		score, reason, err := judgeReply(ctx, e.Judge, check.Criteria, user, reply)
+		if err != nil {
+			r.Detail = "评审失败: " + err.Error()
+			return r
+		}
+		minScore := check.MinScore
+		if minScore == 0 {
+			minScore = 3
+		}
+		r.Passed = score >= minScore
+		r.Detail = fmt.Sprintf("score=%d %s", score, reason)
+	}
+	return r
+}
+
+// findPromptLeak 检查回复是否包含系统提示词中连续 promptLeakWindow 个字，返回泄露的片段
+func findPromptLeak(prompt, reply string) string {
+	const promptLeakWindow = 12
+	strip := func(s string) []rune {
+		var out []rune
+		for _, r := range s {
+			if !unicode.IsSpace(r) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	p := strip(prompt)
+	text := string(strip(reply))
+	for i := 0; i+promptLeakWindow <= len(p); i++ {
+		window := string(p[i : i+promptLeakWindow])
+		if strings.Contains(text, window) {
+			return window
+		}
+	}
+	return ""
+}
+
+// judgeReply 让评审模型按标准打分
+func judgeReply(ctx context.Context, judge LLMProvider, criteria, user, reply string) (int, string, error) {
+	prompt := fmt.Sprintf("你是心理咨询对话的质量评审。评判标准：%s\n\n用户消息：%s\n\n咨询师回复：%s\n\n"+
+		`请只输出JSON，格式为 {"score": 1到5的整数, "reason": "简短理由"}`, criteria, user, reply)
+	res, err := judge.Chat(ctx, LLMRequest{Messages: []LLMMessage{{Role: "user", Content: prompt}}}, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	start, end := strings.Index(res.Content, "{"), strings.LastIndex(res.Content, "}")
+	if start < 0 || end < start {
+		return 0, "", fmt.Errorf("评审输出不是JSON: %s", res.Content)
+	}
+	var verdict struct {
+		Score  int    `json:"score"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[start:end+1]), &verdict); err != nil {
+		return 0, "", err
+	}
+	if verdict.Score < 1 || verdict.Score > 5 {
+		return 0, "", fmt.Errorf("评审分数越界: %d", verdict.Score)
+	}
+	return verdict.Score, verdict.Reason, nil
+}
+
+// Markdown 渲染评估报告
+func (r *EvalReport) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# 评估报告 %s\n\n提示词：%s　模型：%s　通过：%d/%d\n\n", r.Suite, r.Prompt, r.Provider, r.Passed, r.Total)
+	for _, c := range r.Cases {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&sb, "- [%s] %s", status, c.ID)
+		if c.Error != "" {
+			fmt.Fprintf(&sb, "（调用失败：%s）", c.Error)
+		}
+		sb.WriteString("\n")
+		for _, t := range c.Turns {
+			for _, check := range t.Checks {
+				if !check.Passed && !check.Skipped {
+					fmt.Fprintf(&sb, "  - %s 未通过：%s\n    回复：%s\n", check.Type, check.Detail, t.Reply)
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// EvalDiff 两个提示词版本的评估差异
+type EvalDiff struct {
+	Base         *EvalReport `json:"base"`
+	Candidate    *EvalReport `json:"candidate"`
+	Regressions  []string    `json:"regressions"`  // base通过、candidate未通过
+	Improvements []string    `json:"improvements"` // base未通过、candidate通过
+}
+
+// DiffEvalReports 对比同一用例集在两个提示词上的结果
+func DiffEvalReports(base, candidate *EvalReport) *EvalDiff {
+	diff := &EvalDiff{Base: base, Candidate: candidate}
+	basePassed := map[string]bool{}
+	for _, c := range base.Cases {
+		basePassed[c.ID] = c.Passed
+	}
+	for _, c := range candidate.Cases {
+		passed, ok := basePassed[c.ID]
+		if !ok {
+			continue
+		}
+		if passed && !c.Passed {
+			diff.Regressions = append(diff.Regressions, c.ID)
+		} else if !passed && c.Passed {
+			diff.Improvements = append(diff.Improvements, c.ID)
+		}
+	}
+	return diff
+}
+
+// Markdown 渲染差异报告
+func (d *EvalDiff) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# 提示词对比 %s\n\n", d.Base.Suite)
+	fmt.Fprintf(&sb, "| 提示词 | 通过 |\n|---|---|\n| %s | %d/%d |\n| %s | %d/%d |\n\n",
+		d.Base.Prompt, d.Base.Passed, d.Base.Total, d.Candidate.Prompt, d.Candidate.Passed, d.Candidate.Total)
+	fmt.Fprintf(&sb, "退化（%d）：%s\n\n", len(d.Regressions), strings.Join(d.Regressions, ", "))
+	fmt.Fprintf(&sb, "改进（%d）：%s\n\n", len(d.Improvements), strings.Join(d.Improvements, ", "))
+	sb.WriteString(d.Candidate.Markdown())
+	return sb.String()
+}
+
+// offTopicMarkers 离线假模型识别越界请求的关键词
+var offTopicMarkers = []string{"代码", "程序", "写一首", "诗", "天气", "提示词", "prompt", "忽略", "扮演", "翻译", "股票"}
+
+// NewFakeCounselorProvider 离线评估用的规则假模型：越界请求给出拒绝，其余给出固定的咨询式回复
+func NewFakeCounselorProvider() *ScriptedProvider {
+	return &ScriptedProvider{Respond: func(req LLMRequest) (*LLMResult, error) {
+		last := ""
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if req.Messages[i].Role == "user" {
+				last = strings.ToLower(req.Messages[i].Content)
+				break
+			}
+		}
+		for _, m := range offTopicMarkers {
+			if strings.Contains(last, m) {
+				return &LLMResult{Content: "抱歉，我只能帮助你处理戒除性瘾相关的问题。请描述你当前在戒瘾上遇到的困难，我们一起想办法。"}, nil
+			}
+		}
+		if strings.Contains(last, "破戒") {
+			return &LLMResult{Content: "破戒并不代表失败，先别过度自责。回想一下破戒前发生了什么、当时的情绪和环境，把诱因记录下来，今天重新开始打卡。"}, nil
+		}
+		return &LLMResult{Content: "我理解你现在的感受。冲动来临时，可以先离开当前环境，做几次深呼吸或运动来转移注意力。能具体说说这种冲动通常在什么时候出现吗？"}, nil
+	}}
+}
+
+// NewFakeJudgeProvider 离线评估用的假评审，固定给4分
+func NewFakeJudgeProvider() *ScriptedProvider {
+	return &ScriptedProvider{Respond: func(req LLMRequest) (*LLMResult, error) {
+		return &LLMResult{Content: `{"score": 4, "reason": "fake judge"}`}, nil
+	}}
+}
+
+// loadEvalPrompt 加载评估用系统提示词：文件优先；版本0为内置 RolePrompt；其他版本从数据库读取
+func loadEvalPrompt(version int, file string) (string, string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", "", err
+		}
+		prompt, err := renderPrompt(string(data), evalPromptVars)
+		return prompt, file, err
+	}
+	if version == 0 {
+		return common.RolePrompt, "builtin", nil
+	}
+	if db.GetDB() == nil {
+		db.InitDB()
+	}
+	var tmpl db.PromptTemplate
+	if err := db.GetDB().Where("name = ? AND version = ?", CounselorPromptName, version).First(&tmpl).Error; err != nil {
+		return "", "", fmt.Errorf("提示词版本 %d 不存在: %v", version, err)
+	}
+	prompt, err := renderPrompt(tmpl.Content, evalPromptVars)
+	return prompt, fmt.Sprintf("v%d", version), err
+}
+
+// evalPromptVars 评估时模板变量的取值
+var evalPromptVars = PromptVars{Nickname: "戒友", CurrentStreak: 3, DaysSinceLastBreak: 3}
+
+// RunEvalCommand eval 子命令入口，返回进程退出码
+// 单次评估有用例未通过时返回1；对比模式下候选版本有退化时返回1
+func RunEvalCommand(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	suitePath := fs.String("suite", "eval/counselor.yaml", "用例集YAML路径")
+	provider := fs.String("provider", "fake", "模型：fake（离线规则模型）或 hunyuan")
+	promptVersion := fs.Int("prompt-version", 0, "提示词版本，0 为内置提示词")
+	promptFile := fs.String("prompt-file", "", "从文件读取提示词，优先于 -prompt-version")
+	compareVersion := fs.Int("compare", -1, "对比的提示词版本，-1 表示不对比")
+	compareFile := fs.String("compare-file", "", "从文件读取对比提示词，优先于 -compare")
+	judge := fs.Bool("judge", false, "启用大模型评审（judge 检查）")
+	out := fs.String("out", "", "将JSON报告写入文件")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	suite, err := LoadEvalSuite(*suitePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	evaluator := &Evaluator{MaxTokens: MaxTokenPerMsg}
+	switch *provider {
+	case "fake":
+		evaluator.Provider = NewFakeCounselorProvider()
+		if *judge {
+			evaluator.Judge = NewFakeJudgeProvider()
+		}
+	case "hunyuan":
+		evaluator.Provider = getAIProvider()
+		if *judge {
+			evaluator.Judge = getAIProvider()
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "unknown provider:", *provider)
+		return 2
+	}
+
+	run := func(version int, file string) (*EvalReport, error) {
+		prompt, label, err := loadEvalPrompt(version, file)
+		if err != nil {
+			return nil, err
+		}
+		evaluator.SystemPrompt, evaluator.PromptLabel = prompt, label
+		return evaluator.Run(context.Background(), suite), nil
+	}
+	base, err := run(*promptVersion, *promptFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var result any = base
+	exitCode := 0
+	if *compareVersion >= 0 || *compareFile != "" {
+		candidate, err := run(*compareVersion, *compareFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		diff := DiffEvalReports(base, candidate)
+		fmt.Print(diff.Markdown())
+		result = diff
+		if len(diff.Regressions) > 0 {
+			exitCode = 1
+		}
+	} else {
+		fmt.Print(base.Markdown())
+		if base.Passed < base.Total {
+			exitCode = 1
+		}
+	}
+
+	if *out != "" {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	return exitCode
+}
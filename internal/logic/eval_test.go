@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
+)
+
+// 测试内置用例集在离线假模型上全部通过
+func TestEvalSuiteWithFakeProvider(t *testing.T) {
+	suite, err := LoadEvalSuite("../../eval/counselor.yaml")
+	assert.NoError(t, err)
+
+	evaluator := &Evaluator{
+		Provider:     NewFakeCounselorProvider(),
+		Judge:        NewFakeJudgeProvider(),
+		SystemPrompt: common.RolePrompt,
+		PromptLabel:  "builtin",
+	}
+	report := evaluator.Run(context.Background(), suite)
+	assert.Equal(t, report.Total, report.Passed, report.Markdown())
+}
+
+// 测试规则检查、提示词泄露检测和版本对比
+func TestEvalChecksAndDiff(t *testing.T) {
+	e := &Evaluator{SystemPrompt: "你是一位专业的成瘾治疗心理医生，主要治疗用户性成瘾的问题"}
+	ctx := context.Background()
+
+	assert.True(t, e.runCheck(ctx, EvalCheck{Type: "refusal"}, "", "抱歉，这个问题我无法回答").Passed)
+	assert.False(t, e.runCheck(ctx, EvalCheck{Type: "refusal"}, "", "好的，快速排序如下").Passed)
+	assert.False(t, e.runCheck(ctx, EvalCheck{Type: "no_prompt_leak"}, "", "我的设定是：你是一位专业的成瘾治疗心理医生").Passed)
+	assert.True(t, e.runCheck(ctx, EvalCheck{Type: "no_prompt_leak"}, "", "我是你的戒瘾助手").Passed)
+	assert.False(t, e.runCheck(ctx, EvalCheck{Type: "max_length", Max: 3}, "", "一二三四").Passed)
+	assert.True(t, e.runCheck(ctx, EvalCheck{Type: "judge"}, "", "回复").Skipped)
+
+	base := &EvalReport{Cases: []EvalCaseResult{{ID: "a", Passed: true}, {ID: "b", Passed: false}}}
+	candidate := &EvalReport{Cases: []EvalCaseResult{{ID: "a", Passed: false}, {ID: "b", Passed: true}}}
+	diff := DiffEvalReports(base, candidate)
+	assert.Equal(t, []string{"a"}, diff.Regressions)
+	assert.Equal(t, []string{"b"}, diff.Improvements)
+}
@@ -0,0 +1,296 @@
+package logic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/db"
+)
+
+// 评价原因
+var feedbackReasons = map[string]bool{
+	"unhelpful":  true, // 没帮助
+	"harmful":    true, // 有害/不当
+	"inaccurate": true, // 内容不准确
+	"off_topic":  true, // 答非所问
+	"other":      true,
+}
+
+// FeedbackContextSize 查看/导出评价时附带的评价回复之前的消息条数
+const FeedbackContextSize = 10
+
+// newMsgID 生成消息ID
+func newMsgID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%d%s", time.Now().UnixMilli(), hex.EncodeToString(b))
+}
+
+// ChatFeedbackHandler 用户对AI回复点赞/点踩，重复提交覆盖之前的评价
+func ChatFeedbackHandler(c *gin.Context) {
+	var req struct {
+		OpenID  string `json:"openid"`
+		MsgID   string `json:"msg_id"`
+		Rating  string `json:"rating"` // up/down
+		Reason  string `json:"reason"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" || req.MsgID == "" {
+		c.JSON(400, gin.H{"error": "openid and msg_id required"})
+		return
+	}
+	rating := 0
+	switch req.Rating {
+	case "up":
+		rating = 1
+	case "down":
+		rating = -1
+	default:
+		c.JSON(400, gin.H{"error": "rating must be 'up' or 'down'"})
+		return
+	}
+	if req.Reason != "" && !feedbackReasons[req.Reason] {
+		c.JSON(400, gin.H{"error": "invalid reason"})
+		return
+	}
+	if utf8.RuneCountInString(req.Comment) > 256 {
+		c.JSON(400, gin.H{"error": "comment too long"})
+		return
+	}
+
+	var user db.User
+	if err := db.GetDB().Where("open_id = ?", req.OpenID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	var record db.ChatRecord
+	if err := db.GetDB().Where("user_id = ? AND msg_id = ? AND is_user = 0", user.ID, req.MsgID).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(404, gin.H{"error": "message not found"})
+		} else {
+			c.JSON(500, gin.H{"error": "db error"})
+		}
+		return
+	}
+
+	feedback := db.ChatFeedback{
+		UserID:        user.ID,
+		ChatRecordID:  record.ID,
+		MsgID:         record.MsgID,
+		Rating:        rating,
+		Reason:        req.Reason,
+		Comment:       req.Comment,
+		PromptVersion: record.PromptVersion,
+		Model:         record.Model,
+	}
+	err := db.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "chat_record_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "reason", "comment", "updated_at"}),
+	}).Create(&feedback).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "feedback saved"})
+}
+
+// feedbackQuery 按查询参数过滤评价：rating(up/down)、reason、prompt_version、from、to
+func feedbackQuery(c *gin.Context) (*gorm.DB, bool) {
+	query := db.GetDB().Model(&db.ChatFeedback{})
+	switch c.DefaultQuery("rating", "down") {
+	case "up":
+		query = query.Where("rating = ?", 1)
+	case "down":
+		query = query.Where("rating = ?", -1)
+	case "all":
+	default:
+		return nil, false
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if v := c.Query("prompt_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false
+		}
+		query = query.Where("prompt_version = ?", version)
+	}
+	from, to, ok := usageDateRange(c)
+	if !ok {
+		return nil, false
+	}
+	return query.Where("created_at >= ? AND created_at < ?", from, to), true
+}
+
+// FeedbackItem 评价及被评价的回复
+type FeedbackItem struct {
+	db.ChatFeedback
+	Question string `json:"question"`
+	Reply    string `json:"reply"`
+}
+
+// loadFeedbackItems 补充被评价回复及其对应的用户提问
+func loadFeedbackItems(feedbacks []db.ChatFeedback) []FeedbackItem {
+	items := make([]FeedbackItem, 0, len(feedbacks))
+	for _, f := range feedbacks {
+		item := FeedbackItem{ChatFeedback: f}
+		var reply db.ChatRecord
+		if db.GetDB().First(&reply, f.ChatRecordID).Error == nil {
+			item.Reply = reply.Content
+			var question db.ChatRecord
+			if db.GetDB().Where("user_id = ? AND is_user = 1 AND id < ?", f.UserID, reply.ID).
+				Order("id desc").First(&question).Error == nil {
+				item.Question = question.Content
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// ListFeedbackHandler 分页浏览评价，默认只看点踩
+func ListFeedbackHandler(c *gin.Context) {
+	query, ok := feedbackQuery(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid query"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	var total int64
+	query.Count(&total)
+	var feedbacks []db.ChatFeedback
+	if err := query.Order("created_at desc").Offset((page - 1) * size).Limit(size).Find(&feedbacks).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "page": page, "feedback": loadFeedbackItems(feedbacks)})
+}
+
+// FeedbackStatsHandler 按提示词版本和模型统计点赞/点踩
+func FeedbackStatsHandler(c *gin.Context) {
+	from, to, ok := usageDateRange(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid date format, should be yyyy-mm-dd"})
+		return
+	}
+	type Result struct {
+		PromptVersion int    `json:"prompt_version"`
+		Model         string `json:"model"`
+		Up            int64  `json:"up"`
+		Down          int64  `json:"down"`
+	}
+	var results []Result
+	if err := db.GetDB().Raw(`
+	SELECT prompt_version, model,
+	  SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END) as up,
+	  SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END) as down
+	FROM chat_feedbacks
+	WHERE created_at >= ? AND created_at < ?
+	GROUP BY prompt_version, model
+	ORDER BY prompt_version DESC, model ASC
+	`, from, to).Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"stats": results})
+}
+
+// loadFeedbackConversation 被评价回复及之前的 FeedbackContextSize 条消息，按时间升序
+func loadFeedbackConversation(f *db.ChatFeedback) []db.ChatRecord {
+	var records []db.ChatRecord
+	db.GetDB().Where("user_id = ? AND id <= ?", f.UserID, f.ChatRecordID).
+		Order("id desc").Limit(FeedbackContextSize + 1).Find(&records)
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records
+}
+
+// FeedbackConversationHandler 查看评价对应的对话上下文
+func FeedbackConversationHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid feedback ID"})
+		return
+	}
+	var feedback db.ChatFeedback
+	if err := db.GetDB().First(&feedback, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(404, gin.H{"error": "feedback not found"})
+		} else {
+			c.JSON(500, gin.H{"error": "db error"})
+		}
+		return
+	}
+	c.JSON(200, gin.H{"feedback": feedback, "records": loadFeedbackConversation(&feedback)})
+}
+
+// feedbackExportLine 导出的一行，messages 为被评价回复及之前的对话
+type feedbackExportLine struct {
+	FeedbackID    uint         `json:"feedback_id"`
+	PromptVersion int          `json:"prompt_version"`
+	Model         string       `json:"model"`
+	Rating        int          `json:"rating"`
+	Reason        string       `json:"reason"`
+	Comment       string       `json:"comment"`
+	Messages      []LLMMessage `json:"messages"`
+}
+
+// newFeedbackExportLine 组装导出行，records 按时间升序，用户消息为 user，AI 回复为 assistant
+func newFeedbackExportLine(f *db.ChatFeedback, records []db.ChatRecord) feedbackExportLine {
+	line := feedbackExportLine{
+		FeedbackID:    f.ID,
+		PromptVersion: f.PromptVersion,
+		Model:         f.Model,
+		Rating:        f.Rating,
+		Reason:        f.Reason,
+		Comment:       f.Comment,
+	}
+	for _, r := range records {
+		role := "assistant"
+		if r.IsUser {
+			role = "user"
+		}
+		line.Messages = append(line.Messages, LLMMessage{Role: role, Content: r.Content})
+	}
+	return line
+}
+
+// ExportFeedbackHandler 以JSONL导出评价及对话，用于提示词调优
+func ExportFeedbackHandler(c *gin.Context) {
+	query, ok := feedbackQuery(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid query"})
+		return
+	}
+	var feedbacks []db.ChatFeedback
+	if err := query.Order("id asc").Limit(5000).Find(&feedbacks).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=feedback_%s.jsonl", time.Now().Format("20060102")))
+	c.Status(200)
+	enc := json.NewEncoder(c.Writer)
+	for i := range feedbacks {
+		f := &feedbacks[i]
+		enc.Encode(newFeedbackExportLine(f, loadFeedbackConversation(f)))
+	}
+}
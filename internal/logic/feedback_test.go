@@ -0,0 +1,70 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试导出行的字段及消息角色
+func TestNewFeedbackExportLine(t *testing.T) {
+	f := db.ChatFeedback{ChatRecordID: 12, Rating: -1, Reason: "unhelpful", Comment: "太敷衍", PromptVersion: 3, Model: "hunyuan-lite"}
+	f.ID = 7
+	records := []db.ChatRecord{
+		{IsUser: true, Content: "晚上总是睡不着"},
+		{IsUser: false, Content: "可以试试睡前放下手机"},
+		{IsUser: true, Content: "还是不行"},
+		{IsUser: false, Content: "多喝热水"},
+	}
+	line := newFeedbackExportLine(&f, records)
+	assert.Equal(t, []LLMMessage{
+		{Role: "user", Content: "晚上总是睡不着"},
+		{Role: "assistant", Content: "可以试试睡前放下手机"},
+		{Role: "user", Content: "还是不行"},
+		{Role: "assistant", Content: "多喝热水"},
+	}, line.Messages)
+
+	b, err := json.Marshal(line)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "\n")
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.ElementsMatch(t, []string{"feedback_id", "prompt_version", "model", "rating", "reason", "comment", "messages"}, slices.Collect(maps.Keys(got)))
+	assert.Equal(t, float64(7), got["feedback_id"])
+	assert.Equal(t, float64(3), got["prompt_version"])
+	assert.Equal(t, "hunyuan-lite", got["model"])
+	assert.Equal(t, float64(-1), got["rating"])
+	assert.Equal(t, "unhelpful", got["reason"])
+	assert.Equal(t, "太敷衍", got["comment"])
+	assert.Equal(t, map[string]any{"role": "user", "content": "晚上总是睡不着"}, got["messages"].([]any)[0])
+
+	// 找不到对话时 messages 为 null
+	line = newFeedbackExportLine(&f, nil)
+	assert.Nil(t, line.Messages)
+}
+
+// 测试评价参数校验
+func TestChatFeedbackInvalidParams(t *testing.T) {
+	router := setupTestRouter()
+	for _, body := range []string{
+		`{"msg_id":"m1","rating":"up"}`,
+		`{"openid":"o1","rating":"up"}`,
+		`{"openid":"o1","msg_id":"m1","rating":"like"}`,
+		`{"openid":"o1","msg_id":"m1","rating":"down","reason":"boring"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/chat/feedback", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code, body)
+	}
+}
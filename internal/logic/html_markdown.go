@@ -0,0 +1,178 @@
+package logic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var htmlSpaceRe = regexp.MustCompile(`\s+`)
+
+// htmlToMarkdown 将导入内容中的HTML转换为 Markdown，只保留段落、标题、列表、引用、代码、链接和图片等常用格式
+func htmlToMarkdown(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(markdownNode(n))
+	}
+	return tidyMarkdown(sb.String())
+}
+
+// htmlPlainText 提取HTML中的纯文本，合并空白，超过 maxRunes 时截断
+func htmlPlainText(s string, maxRunes int) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(nodeText(n) + " ")
+	}
+	text := strings.TrimSpace(htmlSpaceRe.ReplaceAllString(sb.String(), " "))
+	if utf8.RuneCountInString(text) > maxRunes {
+		text = string([]rune(text)[:maxRunes]) + "…"
+	}
+	return text
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+		return ""
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+		if c.Type == html.ElementNode && (c.Data == "p" || c.Data == "br" || c.Data == "li") {
+			sb.WriteString(" ")
+		}
+	}
+	return sb.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func markdownChildren(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(markdownNode(c))
+	}
+	return sb.String()
+}
+
+func markdownNode(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return htmlSpaceRe.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	block := func(s string) string {
+		if s = strings.TrimSpace(s); s == "" {
+			return ""
+		}
+		return "\n\n" + s + "\n\n"
+	}
+	wrap := func(mark string) string {
+		if s := strings.TrimSpace(markdownChildren(n)); s != "" {
+			return mark + s + mark
+		}
+		return ""
+	}
+	switch n.Data {
+	case "script", "style", "iframe", "noscript", "form":
+		return ""
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return block(strings.Repeat("#", int(n.Data[1]-'0')) + " " + strings.TrimSpace(markdownChildren(n)))
+	case "p", "div", "section", "article", "figure", "figcaption", "header", "footer", "main", "table":
+		return block(markdownChildren(n))
+	case "tr":
+		return "\n" + markdownChildren(n)
+	case "br":
+		return "\n"
+	case "hr":
+		return "\n\n---\n\n"
+	case "strong", "b":
+		return wrap("**")
+	case "em", "i":
+		return wrap("*")
+	case "code":
+		return wrap("`")
+	case "pre":
+		return "\n\n```\n" + strings.Trim(nodeText(n), "\n") + "\n```\n\n"
+	case "a":
+		text := strings.TrimSpace(markdownChildren(n))
+		href := htmlAttr(n, "href")
+		if text == "" || !(strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://")) {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s)", text, href)
+	case "img":
+		if src := htmlAttr(n, "src"); src != "" {
+			return fmt.Sprintf("![%s](%s)", htmlAttr(n, "alt"), src)
+		}
+		return ""
+	case "ul", "ol":
+		var sb strings.Builder
+		i := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Data != "li" {
+				continue
+			}
+			i++
+			prefix := "- "
+			if n.Data == "ol" {
+				prefix = fmt.Sprintf("%d. ", i)
+			}
+			// 列表项内的后续行（含嵌套列表）缩进到列表标记之后
+			item := strings.TrimSpace(markdownChildren(c))
+			item = strings.ReplaceAll(item, "\n", "\n"+strings.Repeat(" ", len(prefix)))
+			sb.WriteString(prefix + item + "\n")
+		}
+		return block(sb.String())
+	case "blockquote":
+		s := strings.TrimSpace(tidyMarkdown(markdownChildren(n)))
+		if s == "" {
+			return ""
+		}
+		return block("> " + strings.ReplaceAll(s, "\n", "\n> "))
+	default:
+		return markdownChildren(n)
+	}
+}
+
+// tidyMarkdown 去掉行尾空白，合并连续空行
+func tidyMarkdown(s string) string {
+	var out []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if strings.TrimSpace(line) == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
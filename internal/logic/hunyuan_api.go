@@ -1,7 +1,10 @@
 package logic
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 
@@ -11,7 +14,8 @@ import (
 )
 
 // HunyuanStreamSDK 使用腾讯云官方Go SDK流式API
-func HunyuanStreamSDK(messages []*v20230901.Message, model string, onDelta func(string)) error {
+// 返回本次调用的Token统计（服务端未返回时为nil）及模型请求的工具调用
+func HunyuanStreamSDK(ctx context.Context, messages []*v20230901.Message, tools []*v20230901.Tool, model string, onDelta func(string)) (*v20230901.Usage, []LLMToolCall, error) {
 	credential := common.NewCredential(
 		os.Getenv("TENCENTCLOUD_SECRETID"),
 		os.Getenv("TENCENTCLOUD_SECRETKEY"),
@@ -21,25 +25,83 @@ func HunyuanStreamSDK(messages []*v20230901.Message, model string, onDelta func(
 	cpf.Debug = false
 	client, err := v20230901.NewClient(credential, "", cpf)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	req := v20230901.NewChatCompletionsRequest()
 	req.Model = common.StringPtr(model)
 	req.Messages = messages
 	req.Stream = common.BoolPtr(true)
+	if len(tools) > 0 {
+		req.Tools = tools
+	}
 
-	resp, err := client.ChatCompletions(req)
+	resp, err := client.ChatCompletionsWithContext(ctx, req)
 	if err != nil {
 		log.Printf("[HunyuanSDK] ChatCompletions error: %v\n", err)
+		return nil, nil, err
+	}
+	if resp == nil || resp.Events == nil {
+		return nil, nil, errors.New("hunyuan sdk: empty stream response")
 	}
+
+	var usage *v20230901.Usage
+	var toolCalls []LLMToolCall
 	for event := range resp.Events {
+		if event.Err != nil {
+			return usage, toolCalls, event.Err
+		}
 		var respParams v20230901.ChatCompletionsResponseParams
-		err := json.Unmarshal(event.Data, &respParams)
-		if err != nil {
+		if err := json.Unmarshal(event.Data, &respParams); err != nil {
 			log.Printf("Unmarshal resp error: %v", err)
+			continue
+		}
+		if respParams.ErrorMsg != nil && respParams.ErrorMsg.Msg != nil {
+			return usage, toolCalls, fmt.Errorf("hunyuan sdk stream error: %s", *respParams.ErrorMsg.Msg)
+		}
+		if respParams.Usage != nil {
+			usage = respParams.Usage
+		}
+		if len(respParams.Choices) == 0 || respParams.Choices[0] == nil {
+			continue
+		}
+		delta := respParams.Choices[0].Delta
+		if delta == nil {
+			continue
+		}
+		toolCalls = mergeHunyuanToolCalls(toolCalls, delta.ToolCalls)
+		if delta.Content == nil || *delta.Content == "" {
+			continue
+		}
+		onDelta(*delta.Content)
+	}
+	return usage, toolCalls, ctx.Err()
+}
+
+// mergeHunyuanToolCalls 合并流式返回的工具调用片段，同一Index的参数依次拼接
+func mergeHunyuanToolCalls(calls []LLMToolCall, deltas []*v20230901.ToolCall) []LLMToolCall {
+	for _, d := range deltas {
+		if d == nil {
+			continue
+		}
+		idx := len(calls)
+		if d.Index != nil {
+			idx = int(*d.Index)
+		}
+		for len(calls) <= idx {
+			calls = append(calls, LLMToolCall{})
+		}
+		if d.Id != nil && *d.Id != "" {
+			calls[idx].ID = *d.Id
+		}
+		if d.Function != nil {
+			if d.Function.Name != nil && *d.Function.Name != "" {
+				calls[idx].Name = *d.Function.Name
+			}
+			if d.Function.Arguments != nil {
+				calls[idx].Arguments += *d.Function.Arguments
+			}
 		}
-		onDelta(*respParams.Choices[0].Delta.Content)
 	}
-	return err
+	return calls
 }
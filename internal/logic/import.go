@@ -0,0 +1,699 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/db"
+)
+
+// 导入相关限制
+const (
+	MaxImportFeedBytes     = 10 << 20 // 订阅源内容上限
+	MaxImportMarkdownBytes = 1 << 20  // 单个 Markdown 文件上限
+	MaxImportItems         = 200      // 单次导入文章数上限
+	importDescRunes        = 120      // 未提供摘要时从正文截取的长度
+)
+
+// 单篇文章的导入结果
+const (
+	ImportStatusCreated   = "created"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusNew       = "new" // 试运行：将会创建
+	ImportStatusFailed    = "failed"
+)
+
+// importItem 待导入的文章，统一导入为草稿
+type importItem struct {
+	Fields    articleFields
+	SourceURL string
+	Origin    string // 订阅源条目或文件名，用于报告
+}
+
+// sourceHash 标题+正文的内容哈希，用于没有原文地址时去重
+func (item *importItem) sourceHash() string {
+	return sha256Hex([]byte(strings.TrimSpace(item.Fields.Title) + "\n" + strings.TrimSpace(item.Fields.Body)))
+}
+
+// ImportResult 单篇文章导入结果
+type ImportResult struct {
+	Origin    string `json:"origin"`
+	Title     string `json:"title"`
+	SourceURL string `json:"source_url,omitempty"`
+	Status    string `json:"status"`
+	ArticleID uint   `json:"article_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport 导入汇总
+type ImportReport struct {
+	DryRun     bool           `json:"dry_run"`
+	Created    int            `json:"created"`
+	Duplicates int            `json:"duplicates"`
+	Failed     int            `json:"failed"`
+	Results    []ImportResult `json:"results"`
+}
+
+func (r *ImportReport) add(res ImportResult) {
+	switch res.Status {
+	case ImportStatusCreated, ImportStatusNew:
+		r.Created++
+	case ImportStatusDuplicate:
+		r.Duplicates++
+	case ImportStatusFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// ImportOptions 导入选项，category/tags 作为条目未指定时的默认值
+type ImportOptions struct {
+	Category string
+	Tags     []string
+	DryRun   bool
+}
+
+var markdownImageRe = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// rssFeed RSS 2.0
+type rssFeed struct {
+	Items []struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        string   `xml:"guid"`
+		Description string   `xml:"description"`
+		Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Author      string   `xml:"author"`
+		Categories  []string `xml:"category"`
+		Enclosure   struct {
+			URL  string `xml:"url,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+}
+
+// atomFeed Atom 1.0
+type atomFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+		Author  struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+// feedEntryItem 由订阅源条目生成导入项：HTML 正文转为 Markdown，封面取正文第一张图
+func feedEntryItem(title, link, summary, content, author string, categories []string, image string) importItem {
+	if content == "" {
+		content = summary
+	}
+	body := htmlToMarkdown(content)
+	desc := htmlPlainText(summary, importDescRunes)
+	if desc == "" {
+		desc = htmlPlainText(content, importDescRunes)
+	}
+	if image == "" {
+		if m := markdownImageRe.FindStringSubmatch(body); m != nil {
+			image = m[1]
+		}
+	}
+	title = truncateRunes(strings.TrimSpace(htmlSpaceRe.ReplaceAllString(title, " ")), MaxArticleTitle)
+	return importItem{
+		Fields: articleFields{
+			Title:  title,
+			Desc:   desc,
+			Img:    image,
+			Body:   body,
+			Author: truncateRunes(strings.TrimSpace(author), MaxArticleAuthor),
+			Tags:   categories,
+		},
+		SourceURL: strings.TrimSpace(link),
+		Origin:    strings.TrimSpace(link),
+	}
+}
+
+// parseFeed 解析 RSS 2.0 或 Atom 订阅源
+func parseFeed(data []byte) ([]importItem, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	var root string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.New("invalid feed: no root element")
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			root = se.Name.Local
+			break
+		}
+	}
+
+	var items []importItem
+	switch root {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("invalid rss feed: %w", err)
+		}
+		for _, it := range feed.Items {
+			link := it.Link
+			if link == "" && strings.HasPrefix(it.GUID, "http") {
+				link = it.GUID
+			}
+			author := it.Creator
+			if author == "" {
+				author = it.Author
+			}
+			image := ""
+			if strings.HasPrefix(it.Enclosure.Type, "image/") {
+				image = it.Enclosure.URL
+			}
+			items = append(items, feedEntryItem(it.Title, link, it.Description, it.Content, author, it.Categories, image))
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("invalid atom feed: %w", err)
+		}
+		for _, e := range feed.Entries {
+			link := ""
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			var categories []string
+			for _, c := range e.Categories {
+				categories = append(categories, c.Term)
+			}
+			items = append(items, feedEntryItem(e.Title, link, e.Summary, e.Content, e.Author.Name, categories, ""))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+	return items, nil
+}
+
+// maxFeedRedirects 下载订阅源时最多跟随的跳转次数
+const maxFeedRedirects = 5
+
+var errFeedAddressBlocked = errors.New("feed address not allowed")
+
+// blockedFeedNetworks 除内网、回环、链路本地地址外禁止访问的网段
+var blockedFeedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"), // 运营商级 NAT
+	mustParseCIDR("198.18.0.0/15"), // 基准测试
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// feedAddressAllowed 订阅源只能访问公网地址，避免通过订阅源或其跳转访问内网服务和云厂商元数据接口
+func feedAddressAllowed(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range blockedFeedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// feedHTTPClient 下载订阅源的客户端：在建立连接时检查解析后的IP，跳转也经过同样的检查，且不走环境变量中的代理
+var feedHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !feedAddressAllowed(ip) {
+					return errFeedAddressBlocked
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxFeedRedirects {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errFeedAddressBlocked
+		}
+		return nil
+	},
+}
+
+// fetchFeed 下载订阅源
+func fetchFeed(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml")
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch feed: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImportFeedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImportFeedBytes {
+		return nil, errors.New("feed too large")
+	}
+	return data, nil
+}
+
+// splitList 拆分逗号（含中文逗号）分隔的字符串
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '，' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// stringList YAML 中既可以写成列表，也可以写成逗号分隔的字符串
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = splitList(value.Value)
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// markdownFrontMatter Markdown 文件头部的 YAML 元数据
+type markdownFrontMatter struct {
+	Title       string     `yaml:"title"`
+	Desc        string     `yaml:"desc"`
+	Description string     `yaml:"description"`
+	Author      string     `yaml:"author"`
+	Category    string     `yaml:"category"`
+	Tags        stringList `yaml:"tags"`
+	Img         string     `yaml:"img"`
+	Cover       string     `yaml:"cover"`
+	Covers      stringList `yaml:"covers"`
+	Source      string     `yaml:"source"`
+}
+
+// splitFrontMatter 拆分 --- 包围的头部元数据和正文
+func splitFrontMatter(content string) (string, string) {
+	content = strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\ufeff")
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content
+	}
+	rest := content[len("---\n"):]
+	if strings.HasPrefix(rest, "---\n") {
+		return "", rest[len("---\n"):]
+	}
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		if strings.HasSuffix(rest, "\n---") {
+			return rest[:len(rest)-len("\n---")], ""
+		}
+		return "", content
+	}
+	return rest[:end], rest[end+len("\n---\n"):]
+}
+
+// parseMarkdownFile 解析带 front matter 的 Markdown 文件
+// 未指定标题时使用正文第一个一级标题（并从正文移除），再退回文件名
+func parseMarkdownFile(name string, data []byte) (importItem, error) {
+	if !utf8.Valid(data) {
+		return importItem{}, errors.New("file is not valid UTF-8")
+	}
+	front, body := splitFrontMatter(string(data))
+	var meta markdownFrontMatter
+	if err := yaml.Unmarshal([]byte(front), &meta); err != nil {
+		return importItem{}, fmt.Errorf("invalid front matter: %w", err)
+	}
+	title := strings.TrimSpace(meta.Title)
+	body = strings.TrimSpace(body)
+	if title == "" && strings.HasPrefix(body, "# ") {
+		line, rest, _ := strings.Cut(body, "\n")
+		title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		body = strings.TrimSpace(rest)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	desc := meta.Desc
+	if desc == "" {
+		desc = meta.Description
+	}
+	if desc == "" {
+		if rendered, err := renderArticleMarkdown(body); err == nil {
+			desc = htmlPlainText(rendered, importDescRunes)
+		}
+	}
+	img := meta.Img
+	if img == "" {
+		img = meta.Cover
+	}
+	return importItem{
+		Fields: articleFields{
+			Title:    truncateRunes(title, MaxArticleTitle),
+			Desc:     desc,
+			Img:      img,
+			Covers:   meta.Covers,
+			Body:     body,
+			Author:   meta.Author,
+			Category: meta.Category,
+			Tags:     meta.Tags,
+		},
+		SourceURL: strings.TrimSpace(meta.Source),
+		Origin:    name,
+	}, nil
+}
+
+// readMarkdownDir 读取目录（含子目录）下的 .md/.markdown 文件
+func readMarkdownDir(dir string) ([]importItem, []ImportResult, error) {
+	var items []importItem
+	var failed []ImportResult
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > MaxImportMarkdownBytes {
+			failed = append(failed, ImportResult{Origin: rel, Status: ImportStatusFailed, Error: "file too large"})
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		item, err := parseMarkdownFile(rel, data)
+		if err != nil {
+			failed = append(failed, ImportResult{Origin: rel, Status: ImportStatusFailed, Error: err.Error()})
+			return nil
+		}
+		items = append(items, item)
+		return nil
+	})
+	return items, failed, err
+}
+
+// findImportedArticle 按原文地址或内容哈希查找已导入的文章
+func findImportedArticle(sourceURL, hash string) uint {
+	query := db.GetDB().Model(&db.Article{}).Select("id")
+	if sourceURL != "" {
+		query = query.Where("source_url = ? OR source_hash = ?", sourceURL, hash)
+	} else {
+		query = query.Where("source_hash = ?", hash)
+	}
+	var ids []uint
+	query.Limit(1).Pluck("id", &ids)
+	if len(ids) == 0 {
+		return 0
+	}
+	return ids[0]
+}
+
+// importArticles 将导入项保存为草稿，按原文地址和内容哈希去重（含同批次内的重复）
+func importArticles(items []importItem, opts ImportOptions) *ImportReport {
+	report := &ImportReport{DryRun: opts.DryRun, Results: []ImportResult{}}
+	seen := map[string]bool{}
+	for i, item := range items {
+		res := ImportResult{Origin: item.Origin, Title: item.Fields.Title, SourceURL: item.SourceURL}
+		if i >= MaxImportItems {
+			res.Status, res.Error = ImportStatusFailed, fmt.Sprintf("too many items, max %d", MaxImportItems)
+			report.add(res)
+			continue
+		}
+		hash := item.sourceHash()
+		if seen[hash] || (item.SourceURL != "" && seen[item.SourceURL]) {
+			res.Status = ImportStatusDuplicate
+			report.add(res)
+			continue
+		}
+		seen[hash] = true
+		if item.SourceURL != "" {
+			seen[item.SourceURL] = true
+		}
+		if id := findImportedArticle(item.SourceURL, hash); id != 0 {
+			res.Status, res.ArticleID = ImportStatusDuplicate, id
+			report.add(res)
+			continue
+		}
+
+		fields := item.Fields
+		fields.Status = db.ArticleStatusDraft
+		if fields.Category == "" {
+			fields.Category = opts.Category
+		}
+		fields.Tags = append(append([]string{}, fields.Tags...), opts.Tags...)
+		article := db.Article{CreatedAt: time.Now(), SourceURL: item.SourceURL, SourceHash: hash}
+		if err := fields.applyTo(&article); err != nil {
+			res.Status, res.Error = ImportStatusFailed, err.Error()
+			report.add(res)
+			continue
+		}
+		if opts.DryRun {
+			res.Status = ImportStatusNew
+			report.add(res)
+			continue
+		}
+		err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&article).Error; err != nil {
+				return err
+			}
+			_, err := saveArticleRevision(tx, &article, "导入："+truncateRunes(item.Origin, 100))
+			return err
+		})
+		if err != nil {
+			log.Printf("[Import] save %q failed: %v", item.Origin, err)
+			res.Status, res.Error = ImportStatusFailed, "db error"
+		} else {
+			res.Status, res.ArticleID = ImportStatusCreated, article.ID
+		}
+		report.add(res)
+	}
+	return report
+}
+
+// ImportArticlesHandler 管理员导入文章，均保存为草稿
+// JSON：{"feed_url": "...", "category": "...", "tags": [...], "dry_run": false}
+// 或 multipart：多个 files 字段上传 Markdown 文件，category/tags(逗号分隔)/dry_run 为表单字段
+func ImportArticlesHandler(c *gin.Context) {
+	var items []importItem
+	var failed []ImportResult
+	var opts ImportOptions
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportFeedBytes)
+		form, err := c.MultipartForm()
+		if err != nil || len(form.File["files"]) == 0 {
+			c.JSON(400, gin.H{"error": "files required"})
+			return
+		}
+		opts.Category = c.PostForm("category")
+		opts.Tags = splitList(c.PostForm("tags"))
+		opts.DryRun = c.PostForm("dry_run") == "true"
+		for _, fh := range form.File["files"] {
+			res := ImportResult{Origin: fh.Filename, Status: ImportStatusFailed}
+			if fh.Size > MaxImportMarkdownBytes {
+				res.Error = "file too large"
+				failed = append(failed, res)
+				continue
+			}
+			f, err := fh.Open()
+			if err != nil {
+				res.Error = "read file failed"
+				failed = append(failed, res)
+				continue
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err == nil {
+				var item importItem
+				if item, err = parseMarkdownFile(fh.Filename, data); err == nil {
+					items = append(items, item)
+					continue
+				}
+			}
+			res.Error = err.Error()
+			failed = append(failed, res)
+		}
+	} else {
+		var req struct {
+			FeedURL  string   `json:"feed_url"`
+			Category string   `json:"category"`
+			Tags     []string `json:"tags"`
+			DryRun   bool     `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || !(strings.HasPrefix(req.FeedURL, "http://") || strings.HasPrefix(req.FeedURL, "https://")) {
+			c.JSON(400, gin.H{"error": "feed_url or markdown files required"})
+			return
+		}
+		opts = ImportOptions{Category: req.Category, Tags: req.Tags, DryRun: req.DryRun}
+		data, err := fetchFeed(c.Request.Context(), req.FeedURL)
+		if err != nil {
+			log.Printf("[Import] 下载订阅源 %s 失败: %v", req.FeedURL, err)
+			c.JSON(502, gin.H{"error": "fetch feed failed"})
+			return
+		}
+		if items, err = parseFeed(data); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	report := importArticles(items, opts)
+	for _, res := range failed {
+		report.add(res)
+	}
+	c.JSON(200, report)
+}
+
+// RunImportCommand 命令行导入文章：
+//
+//	go run . import --feed https://example.com/rss --feed https://example.org/atom.xml
+//	go run . import --dir ./drafts --category 经验分享 --dry-run
+func RunImportCommand(args []string) int {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	var feeds []string
+	fset.Func("feed", "RSS/Atom 订阅源地址或本地文件，可重复", func(s string) error {
+		feeds = append(feeds, s)
+		return nil
+	})
+	dir := fset.String("dir", "", "Markdown 文件目录")
+	category := fset.String("category", "", "默认分类")
+	tags := fset.String("tags", "", "追加的标签，逗号分隔")
+	dryRun := fset.Bool("dry-run", false, "只解析和去重，不写入数据库")
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	if len(feeds) == 0 && *dir == "" {
+		fmt.Fprintln(os.Stderr, "import: --feed or --dir required")
+		return 2
+	}
+
+	var items []importItem
+	var failed []ImportResult
+	for _, feed := range feeds {
+		var data []byte
+		var err error
+		if strings.HasPrefix(feed, "http://") || strings.HasPrefix(feed, "https://") {
+			data, err = fetchFeed(context.Background(), feed)
+		} else {
+			data, err = os.ReadFile(feed)
+		}
+		var parsed []importItem
+		if err == nil {
+			parsed, err = parseFeed(data)
+		}
+		if err != nil {
+			failed = append(failed, ImportResult{Origin: feed, Status: ImportStatusFailed, Error: err.Error()})
+			continue
+		}
+		items = append(items, parsed...)
+	}
+	if *dir != "" {
+		parsed, parseFailed, err := readMarkdownDir(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		items = append(items, parsed...)
+		failed = append(failed, parseFailed...)
+	}
+
+	report := importArticles(items, ImportOptions{Category: *category, Tags: splitList(*tags), DryRun: *dryRun})
+	for _, res := range failed {
+		report.add(res)
+	}
+	for _, res := range report.Results {
+		line := fmt.Sprintf("%-9s %s", res.Status, res.Origin)
+		if res.Title != "" {
+			line += "  《" + res.Title + "》"
+		}
+		if res.ArticleID != 0 {
+			line += fmt.Sprintf("  #%d", res.ArticleID)
+		}
+		if res.Error != "" {
+			line += "  " + res.Error
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("created %d, duplicates %d, failed %d\n", report.Created, report.Duplicates, report.Failed)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
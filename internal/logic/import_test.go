@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试HTML转换为 Markdown
+func TestHTMLToMarkdown(t *testing.T) {
+	md := htmlToMarkdown(`<h2>第一周</h2>
+<p>最难熬的是<strong>前三天</strong>，可以看看<a href="https://example.com/a">这篇文章</a>。</p>
+<ul><li>早睡</li><li>运动<ul><li>跑步</li></ul></li></ul>
+<blockquote><p>坚持就是胜利</p></blockquote>
+<p><img src="https://example.com/1.jpg" alt="图"></p>
+<script>alert(1)</script>`)
+	assert.Equal(t, "## 第一周\n\n"+
+		"最难熬的是**前三天**，可以看看[这篇文章](https://example.com/a)。\n\n"+
+		"- 早睡\n- 运动\n\n  - 跑步\n\n"+
+		"> 坚持就是胜利\n\n"+
+		"![图](https://example.com/1.jpg)", md)
+	assert.Equal(t, "一二三…", htmlPlainText("<p>一二<b>三四</b></p>", 3))
+}
+
+// 测试解析 RSS 和 Atom 订阅源
+func TestParseFeed(t *testing.T) {
+	rss := `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>博客</title>
+<item>
+  <title>戒断第30天</title>
+  <link>https://blog.example.com/30</link>
+  <description>一个月的记录</description>
+  <content:encoded><![CDATA[<p>今天是<em>第30天</em>。</p><img src="https://blog.example.com/30.png">]]></content:encoded>
+  <dc:creator>小明</dc:creator>
+  <category>经验</category>
+</item>
+</channel></rss>`
+	items, err := parseFeed([]byte(rss))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "戒断第30天", items[0].Fields.Title)
+	assert.Equal(t, "https://blog.example.com/30", items[0].SourceURL)
+	assert.Equal(t, "一个月的记录", items[0].Fields.Desc)
+	assert.Equal(t, "今天是*第30天*。\n\n![](https://blog.example.com/30.png)", items[0].Fields.Body)
+	assert.Equal(t, "https://blog.example.com/30.png", items[0].Fields.Img)
+	assert.Equal(t, "小明", items[0].Fields.Author)
+	assert.Equal(t, []string{"经验"}, items[0].Fields.Tags)
+
+	atom := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<entry>
+  <title>如何应对冲动</title>
+  <link rel="alternate" href="https://atom.example.com/urge"/>
+  <summary>几个小方法</summary>
+  <content type="html">&lt;p&gt;深呼吸&lt;/p&gt;</content>
+  <author><name>Lee</name></author>
+  <category term="方法"/>
+</entry>
+</feed>`
+	items, err = parseFeed([]byte(atom))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "如何应对冲动", items[0].Fields.Title)
+	assert.Equal(t, "https://atom.example.com/urge", items[0].SourceURL)
+	assert.Equal(t, "深呼吸", items[0].Fields.Body)
+	assert.Equal(t, []string{"方法"}, items[0].Fields.Tags)
+
+	_, err = parseFeed([]byte("<html><body>not a feed</body></html>"))
+	assert.Error(t, err)
+}
+
+// 测试解析带 front matter 的 Markdown 文件
+func TestParseMarkdownFile(t *testing.T) {
+	item, err := parseMarkdownFile("drafts/a.md", []byte("---\ntitle: 复盘\ncategory: 经验分享\ntags: 复盘, 破戒\nsource: https://example.com/review\n---\n正文第一段\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "复盘", item.Fields.Title)
+	assert.Equal(t, "经验分享", item.Fields.Category)
+	assert.Equal(t, []string{"复盘", "破戒"}, item.Fields.Tags)
+	assert.Equal(t, "https://example.com/review", item.SourceURL)
+	assert.Equal(t, "正文第一段", item.Fields.Body)
+	assert.Equal(t, "正文第一段", item.Fields.Desc)
+
+	// 没有 front matter 时使用一级标题，再退回文件名
+	item, err = parseMarkdownFile("b.md", []byte("# 标题\n\n内容"))
+	require.NoError(t, err)
+	assert.Equal(t, "标题", item.Fields.Title)
+	assert.Equal(t, "内容", item.Fields.Body)
+	item, err = parseMarkdownFile("dir/第三篇.md", []byte("内容"))
+	require.NoError(t, err)
+	assert.Equal(t, "第三篇", item.Fields.Title)
+
+	tags, err := parseMarkdownFile("c.md", []byte("---\ntags: [a, b]\n---\n内容"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, tags.Fields.Tags)
+
+	_, err = parseMarkdownFile("d.md", []byte("---\ntitle: [\n---\n内容"))
+	assert.Error(t, err)
+}
+
+// 测试订阅源不能访问内网、回环和链路本地地址
+func TestFeedAddressAllowed(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.100.100.200", "0.0.0.0", "::1", "fe80::1", "fd00::1"} {
+		assert.False(t, feedAddressAllowed(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"1.1.1.1", "203.0.113.10", "2606:4700::1111"} {
+		assert.True(t, feedAddressAllowed(net.ParseIP(ip)), ip)
+	}
+
+	// 连接本机的订阅源时被拦截
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<rss></rss>"))
+	}))
+	defer srv.Close()
+	_, err := fetchFeed(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, errFeedAddressBlocked)
+}
@@ -0,0 +1,456 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"jieyou-backend/internal/common"
+
+	common_sdk "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	tcerrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	v20230901 "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/hunyuan/v20230901"
+	"github.com/tmc/langchaingo/llms"
+	langopenai "github.com/tmc/langchaingo/llms/openai"
+)
+
+// LLMMessage 发给大模型的一条消息
+// role: system/user/assistant/tool
+type LLMMessage struct {
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	ToolCalls  []LLMToolCall `json:"tool_calls,omitempty"`   // assistant 发起的工具调用
+	ToolCallID string        `json:"tool_call_id,omitempty"` // tool 消息对应的调用ID
+	Name       string        `json:"name,omitempty"`         // tool 消息对应的工具名
+}
+
+// LLMToolDefinition 提供给大模型的工具定义，Parameters 为 JSON Schema
+type LLMToolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// LLMToolCall 大模型请求的一次工具调用，Arguments 为 JSON 字符串
+type LLMToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// LLMRequest 一次大模型调用的参数
+type LLMRequest struct {
+	Messages  []LLMMessage
+	MaxTokens int
+	Tools     []LLMToolDefinition
+}
+
+// LLMResult 一次大模型调用的结果
+type LLMResult struct {
+	Content          string
+	ToolCalls        []LLMToolCall
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LLMProvider 大模型服务提供方
+// onDelta 为nil时表示非流式调用，只关心最终结果
+type LLMProvider interface {
+	Name() string
+	Model() string
+	Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error)
+}
+
+// AI错误码，返回给客户端
+const (
+	AIErrTimeout     = "ai_timeout"      // 调用超时
+	AIErrRateLimited = "ai_rate_limited" // 被限流
+	AIErrUnavailable = "ai_unavailable"  // 所有模型均不可用
+	AIErrInterrupted = "ai_interrupted"  // 流式输出中途失败
+)
+
+// AIError 对外暴露的AI调用错误
+type AIError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *AIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	return e.Code
+}
+
+func (e *AIError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus AI错误对应的HTTP状态码
+func (e *AIError) HTTPStatus() int {
+	switch e.Code {
+	case AIErrTimeout:
+		return http.StatusGatewayTimeout
+	case AIErrRateLimited:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// toAIError 将底层错误归类为对外的AIError
+func toAIError(err error) *AIError {
+	var aiErr *AIError
+	if errors.As(err, &aiErr) {
+		return aiErr
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &AIError{Code: AIErrTimeout, Message: "AI响应超时，请稍后再试", Err: err}
+	case isRateLimitError(err):
+		return &AIError{Code: AIErrRateLimited, Message: "AI服务繁忙，请稍后再试", Err: err}
+	default:
+		return &AIError{Code: AIErrUnavailable, Message: "AI服务暂时不可用，请稍后再试", Err: err}
+	}
+}
+
+func isRateLimitError(err error) bool {
+	var sdkErr *tcerrors.TencentCloudSDKError
+	if errors.As(err, &sdkErr) {
+		return strings.HasPrefix(sdkErr.Code, "RequestLimitExceeded") || strings.HasPrefix(sdkErr.Code, "LimitExceeded")
+	}
+	return strings.Contains(err.Error(), "status code: 429")
+}
+
+// isRetriableLLMError 判断错误是否值得重试（超时、网络错误、限流、服务端5xx）
+func isRetriableLLMError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || isRateLimitError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var sdkErr *tcerrors.TencentCloudSDKError
+	if errors.As(err, &sdkErr) {
+		return strings.HasPrefix(sdkErr.Code, "InternalError") ||
+			strings.HasPrefix(sdkErr.Code, "ResourceUnavailable") ||
+			sdkErr.Code == "ClientError.NetworkError"
+	}
+	msg := err.Error()
+	for _, code := range []string{"status code: 500", "status code: 502", "status code: 503", "status code: 504"} {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// LLMRouter 按顺序尝试多个模型，带超时、重试和降级
+type LLMRouter struct {
+	Providers  []LLMProvider
+	Timeout    time.Duration // 单次尝试的超时时间
+	MaxRetries int           // 每个模型可重试错误的最大重试次数
+	Backoff    time.Duration // 首次重试等待时间，之后指数增长
+
+	// OnCall 每次尝试结束后回调（用于记录用量），可为nil
+	OnCall func(ctx context.Context, p LLMProvider, req LLMRequest, res *LLMResult, err error, latency time.Duration)
+}
+
+func (r *LLMRouter) Name() string {
+	return "router"
+}
+
+func (r *LLMRouter) Model() string {
+	return ""
+}
+
+// Chat 依次调用各模型，直到成功；流式输出一旦开始就不再重试或降级，避免客户端收到重复内容
+func (r *LLMRouter) Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error) {
+	var lastErr error
+	for _, p := range r.Providers {
+		for attempt := 0; attempt <= r.MaxRetries; attempt++ {
+			if attempt > 0 {
+				wait := r.Backoff << (attempt - 1)
+				select {
+				case <-ctx.Done():
+					return nil, toAIError(ctx.Err())
+				case <-time.After(wait):
+				}
+			}
+
+			streamed := false
+			var deltaFn func(string)
+			if onDelta != nil {
+				deltaFn = func(delta string) {
+					streamed = true
+					onDelta(delta)
+				}
+			}
+
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if r.Timeout > 0 {
+				attemptCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+			}
+			start := time.Now()
+			res, err := p.Chat(attemptCtx, req, deltaFn)
+			cancel()
+			if r.OnCall != nil {
+				r.OnCall(ctx, p, req, res, err, time.Since(start))
+			}
+			if err == nil {
+				return res, nil
+			}
+			lastErr = err
+			log.Printf("[LLM] provider %s attempt %d failed: %v", p.Name(), attempt+1, err)
+
+			if streamed {
+				return res, &AIError{Code: AIErrInterrupted, Message: "AI回复中断，请重试", Err: err}
+			}
+			if ctx.Err() != nil {
+				return nil, toAIError(ctx.Err())
+			}
+			if !isRetriableLLMError(err) {
+				break
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no llm provider configured")
+	}
+	return nil, toAIError(lastErr)
+}
+
+// openAICompatProvider 兼容OpenAI协议的模型（混元OpenAI兼容接口）
+type openAICompatProvider struct {
+	model   string
+	baseURL string
+	token   string
+}
+
+func (p *openAICompatProvider) Name() string {
+	return "openai:" + p.model
+}
+
+func (p *openAICompatProvider) Model() string {
+	return p.model
+}
+
+func (p *openAICompatProvider) Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error) {
+	llm, err := langopenai.New(
+		langopenai.WithToken(p.token),
+		langopenai.WithModel(p.model),
+		langopenai.WithBaseURL(p.baseURL))
+	if err != nil {
+		return nil, err
+	}
+	var content []llms.MessageContent
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system":
+			content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, m.Content))
+		case "assistant":
+			mc := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+			if m.Content != "" {
+				mc.Parts = append(mc.Parts, llms.TextContent{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				mc.Parts = append(mc.Parts, llms.ToolCall{
+					ID:           tc.ID,
+					Type:         "function",
+					FunctionCall: &llms.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+				})
+			}
+			content = append(content, mc)
+		case "tool":
+			content = append(content, llms.MessageContent{
+				Role:  llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: m.ToolCallID, Name: m.Name, Content: m.Content}},
+			})
+		default:
+			content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, m.Content))
+		}
+	}
+	var opts []llms.CallOption
+	if req.MaxTokens > 0 {
+		opts = append(opts, llms.WithMaxTokens(req.MaxTokens))
+	}
+	if len(req.Tools) > 0 {
+		var tools []llms.Tool
+		for _, t := range req.Tools {
+			tools = append(tools, llms.Tool{
+				Type:     "function",
+				Function: &llms.FunctionDefinition{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+			})
+		}
+		opts = append(opts, llms.WithTools(tools))
+	}
+	// langchaingo 流式模式下会把工具调用的JSON片段也交给StreamingFunc，带工具时改为非流式，结束后一次性输出
+	streaming := onDelta != nil && len(req.Tools) == 0
+	if streaming {
+		opts = append(opts, llms.WithStreamingFunc(func(_ context.Context, chunk []byte) error {
+			if len(chunk) > 0 {
+				onDelta(string(chunk))
+			}
+			return nil
+		}))
+	}
+	resp, err := llm.GenerateContent(ctx, content, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("empty llm response")
+	}
+	choice := resp.Choices[0]
+	res := &LLMResult{
+		Content:          choice.Content,
+		Provider:         p.Name(),
+		Model:            p.model,
+		PromptTokens:     generationInfoInt(choice.GenerationInfo, "PromptTokens"),
+		CompletionTokens: generationInfoInt(choice.GenerationInfo, "CompletionTokens"),
+	}
+	for _, tc := range choice.ToolCalls {
+		if tc.FunctionCall == nil {
+			continue
+		}
+		res.ToolCalls = append(res.ToolCalls, LLMToolCall{ID: tc.ID, Name: tc.FunctionCall.Name, Arguments: tc.FunctionCall.Arguments})
+	}
+	if !streaming && onDelta != nil && res.Content != "" {
+		onDelta(res.Content)
+	}
+	return res, nil
+}
+
+func generationInfoInt(info map[string]any, key string) int {
+	if v, ok := info[key].(int); ok {
+		return v
+	}
+	return 0
+}
+
+// hunyuanSDKProvider 腾讯云SDK流式接口
+type hunyuanSDKProvider struct {
+	model string
+}
+
+func (p *hunyuanSDKProvider) Name() string {
+	return "hunyuan-sdk:" + p.model
+}
+
+func (p *hunyuanSDKProvider) Model() string {
+	return p.model
+}
+
+func (p *hunyuanSDKProvider) Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error) {
+	var messages []*v20230901.Message
+	for _, m := range req.Messages {
+		msg := &v20230901.Message{
+			Role:    common_sdk.StringPtr(m.Role),
+			Content: common_sdk.StringPtr(m.Content),
+		}
+		if m.ToolCallID != "" {
+			msg.ToolCallId = common_sdk.StringPtr(m.ToolCallID)
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, &v20230901.ToolCall{
+				Id:   common_sdk.StringPtr(tc.ID),
+				Type: common_sdk.StringPtr("function"),
+				Function: &v20230901.ToolCallFunction{
+					Name:      common_sdk.StringPtr(tc.Name),
+					Arguments: common_sdk.StringPtr(tc.Arguments),
+				},
+			})
+		}
+		messages = append(messages, msg)
+	}
+	var tools []*v20230901.Tool
+	for _, t := range req.Tools {
+		params, err := json.Marshal(t.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, &v20230901.Tool{
+			Type: common_sdk.StringPtr("function"),
+			Function: &v20230901.ToolFunction{
+				Name:        common_sdk.StringPtr(t.Name),
+				Description: common_sdk.StringPtr(t.Description),
+				Parameters:  common_sdk.StringPtr(string(params)),
+			},
+		})
+	}
+	var sb strings.Builder
+	usage, toolCalls, err := HunyuanStreamSDK(ctx, messages, tools, p.model, func(delta string) {
+		sb.WriteString(delta)
+		if onDelta != nil {
+			onDelta(delta)
+		}
+	})
+	res := &LLMResult{Content: sb.String(), ToolCalls: toolCalls, Provider: p.Name(), Model: p.model}
+	if usage != nil {
+		if usage.PromptTokens != nil {
+			res.PromptTokens = int(*usage.PromptTokens)
+		}
+		if usage.CompletionTokens != nil {
+			res.CompletionTokens = int(*usage.CompletionTokens)
+		}
+	}
+	if err != nil {
+		return res, err
+	}
+	if res.Content == "" && len(res.ToolCalls) == 0 {
+		return res, errors.New("hunyuan sdk: empty reply")
+	}
+	return res, nil
+}
+
+var (
+	aiProvider     LLMProvider
+	aiProviderOnce sync.Once
+)
+
+// getAIProvider 返回全局AI调用入口：主模型 -> SDK模型（已配置密钥时） -> 备用模型
+func getAIProvider() LLMProvider {
+	aiProviderOnce.Do(func() {
+		if aiProvider != nil {
+			return
+		}
+		providers := []LLMProvider{
+			&openAICompatProvider{model: common.HunyuanModel, baseURL: common.HunyuanBaseUrl, token: common.HunyuanToken},
+		}
+		if os.Getenv("TENCENTCLOUD_SECRETID") != "" {
+			providers = append(providers, &hunyuanSDKProvider{model: common.HunyuanSDKModel})
+		}
+		if common.HunyuanFallbackModel != "" && common.HunyuanFallbackModel != common.HunyuanModel {
+			providers = append(providers, &openAICompatProvider{model: common.HunyuanFallbackModel, baseURL: common.HunyuanBaseUrl, token: common.HunyuanToken})
+		}
+		aiProvider = &LLMRouter{
+			Providers:  providers,
+			Timeout:    common.AITimeout,
+			MaxRetries: common.AIMaxRetries,
+			Backoff:    common.AIRetryBackoff,
+			OnCall:     recordLLMUsage,
+		}
+	})
+	return aiProvider
+}
+
+// SetAIProvider 替换全局AI调用入口（测试或离线评估使用）
+func SetAIProvider(p LLMProvider) {
+	aiProviderOnce.Do(func() {})
+	aiProvider = p
+}
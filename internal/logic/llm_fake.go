@@ -0,0 +1,67 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ScriptedProvider 按脚本返回预设结果的模型，用于测试和离线评估，不访问网络
+// 优先依次消费 Steps，用完后调用 Respond；两者都没有时返回错误
+type ScriptedProvider struct {
+	Steps   []LLMResult
+	Respond func(req LLMRequest) (*LLMResult, error)
+
+	mu       sync.Mutex
+	requests []LLMRequest
+}
+
+func (p *ScriptedProvider) Name() string {
+	return "scripted"
+}
+
+func (p *ScriptedProvider) Model() string {
+	return "scripted"
+}
+
+func (p *ScriptedProvider) Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	var res *LLMResult
+	if len(p.Steps) > 0 {
+		step := p.Steps[0]
+		p.Steps = p.Steps[1:]
+		res = &step
+	}
+	p.mu.Unlock()
+
+	if res == nil {
+		if p.Respond == nil {
+			return nil, errors.New("scripted provider: script exhausted")
+		}
+		var err error
+		if res, err = p.Respond(req); err != nil {
+			return nil, err
+		}
+	}
+	if res.Provider == "" {
+		res.Provider = p.Name()
+	}
+	if res.Model == "" {
+		res.Model = p.Model()
+	}
+	if onDelta != nil && res.Content != "" {
+		onDelta(res.Content)
+	}
+	return res, nil
+}
+
+// Requests 返回收到的全部请求，便于断言
+func (p *ScriptedProvider) Requests() []LLMRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]LLMRequest(nil), p.requests...)
+}
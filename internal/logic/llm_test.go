@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubProvider 按顺序返回预设错误的测试模型
+type stubProvider struct {
+	name   string
+	errs   []error
+	deltas []string
+	calls  int
+	block  bool
+}
+
+func (p *stubProvider) Name() string  { return p.name }
+func (p *stubProvider) Model() string { return p.name }
+
+func (p *stubProvider) Chat(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResult, error) {
+	p.calls++
+	if p.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if onDelta != nil {
+		for _, d := range p.deltas {
+			onDelta(d)
+		}
+	}
+	if len(p.errs) >= p.calls && p.errs[p.calls-1] != nil {
+		return nil, p.errs[p.calls-1]
+	}
+	return &LLMResult{Content: "ok from " + p.name, Provider: p.name}, nil
+}
+
+// 测试可重试错误会在同一模型上重试
+func TestLLMRouterRetry(t *testing.T) {
+	primary := &stubProvider{name: "primary", errs: []error{errors.New("API returned unexpected status code: 503")}}
+	router := &LLMRouter{Providers: []LLMProvider{primary}, MaxRetries: 2, Backoff: time.Millisecond}
+
+	res, err := router.Chat(context.Background(), LLMRequest{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok from primary", res.Content)
+	assert.Equal(t, 2, primary.calls)
+}
+
+// 测试不可重试错误直接降级到备用模型
+func TestLLMRouterFallback(t *testing.T) {
+	primary := &stubProvider{name: "primary", errs: []error{errors.New("API returned unexpected status code: 400")}}
+	fallback := &stubProvider{name: "fallback"}
+	router := &LLMRouter{Providers: []LLMProvider{primary, fallback}, MaxRetries: 2, Backoff: time.Millisecond}
+
+	res, err := router.Chat(context.Background(), LLMRequest{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok from fallback", res.Content)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 1, fallback.calls)
+}
+
+// 测试单次调用超时后返回 ai_timeout
+func TestLLMRouterTimeout(t *testing.T) {
+	slow := &stubProvider{name: "slow", block: true}
+	router := &LLMRouter{Providers: []LLMProvider{slow}, Timeout: 10 * time.Millisecond, MaxRetries: 1, Backoff: time.Millisecond}
+
+	_, err := router.Chat(context.Background(), LLMRequest{}, nil)
+	var aiErr *AIError
+	assert.True(t, errors.As(err, &aiErr))
+	assert.Equal(t, AIErrTimeout, aiErr.Code)
+	assert.Equal(t, 504, aiErr.HTTPStatus())
+	assert.Equal(t, 2, slow.calls)
+}
+
+// 测试流式输出开始后失败不再重试
+func TestLLMRouterNoRetryAfterStream(t *testing.T) {
+	primary := &stubProvider{name: "primary", deltas: []string{"你好"}, errs: []error{errors.New("API returned unexpected status code: 503")}}
+	fallback := &stubProvider{name: "fallback"}
+	router := &LLMRouter{Providers: []LLMProvider{primary, fallback}, MaxRetries: 2, Backoff: time.Millisecond}
+
+	var got string
+	_, err := router.Chat(context.Background(), LLMRequest{}, func(d string) { got += d })
+	var aiErr *AIError
+	assert.True(t, errors.As(err, &aiErr))
+	assert.Equal(t, AIErrInterrupted, aiErr.Code)
+	assert.Equal(t, "你好", got)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 0, fallback.calls)
+}
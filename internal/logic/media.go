@@ -0,0 +1,289 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 媒体类型
+const (
+	MediaKindArticle = "article"
+	MediaKindAvatar  = "avatar"
+)
+
+// maxImagePixels 解码前按图片头部尺寸拦截超大图片，避免解码耗尽内存
+const maxImagePixels = 40000000
+
+// allowedImageTypes 允许上传的图片类型及扩展名，以文件内容嗅探结果为准
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	errUnsupportedImage = errors.New("unsupported image type")
+	errImageTooLarge    = errors.New("image dimensions too large")
+)
+
+// processedImage 处理后的图片及缩略图
+type processedImage struct {
+	Data      []byte
+	MimeType  string
+	Ext       string
+	Width     int
+	Height    int
+	Thumb     []byte
+	ThumbMime string
+}
+
+// scaleSize 按长边不超过 limit 等比缩放
+func scaleSize(w, h, limit int) (int, int) {
+	if limit <= 0 || (w <= limit && h <= limit) {
+		return w, h
+	}
+	if w >= h {
+		return limit, max(h*limit/w, 1)
+	}
+	return max(w*limit/h, 1), limit
+}
+
+func resizeImage(src image.Image, w, h int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// encodeImage PNG 保持 PNG（可能有透明通道），其余编码为 JPEG
+func encodeImage(img image.Image, mimeType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if mimeType == "image/png" {
+		err := png.Encode(&buf, img)
+		return buf.Bytes(), "image/png", err
+	}
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	return buf.Bytes(), "image/jpeg", err
+}
+
+// processImage 嗅探图片类型，超过最大边长时缩小，并生成缩略图
+// GIF 保留原文件以免丢失动画；需要缩小的 WebP 重新编码为 JPEG
+func processImage(data []byte) (*processedImage, error) {
+	mimeType := mimetype.Detect(data).String()
+	ext, ok := allowedImageTypes[mimeType]
+	if !ok {
+		return nil, errUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+	var img image.Image
+	if mimeType == "image/gif" {
+		img, err = gif.Decode(bytes.NewReader(data))
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+
+	out := &processedImage{Data: data, MimeType: mimeType, Ext: ext, Width: cfg.Width, Height: cfg.Height}
+	if w, h := scaleSize(cfg.Width, cfg.Height, common.ImageMaxDimension); mimeType != "image/gif" && (w != cfg.Width || h != cfg.Height) {
+		out.Data, out.MimeType, err = encodeImage(resizeImage(img, w, h), mimeType)
+		if err != nil {
+			return nil, err
+		}
+		out.Ext = allowedImageTypes[out.MimeType]
+		out.Width, out.Height = w, h
+	}
+	tw, th := scaleSize(cfg.Width, cfg.Height, common.ThumbnailSize)
+	out.Thumb, out.ThumbMime, err = encodeImage(resizeImage(img, tw, th), mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mediaKey 存储路径：kind/年月/内容哈希+扩展名，头像在哈希前加上用户ID，不同用户的头像不共用文件
+func mediaKey(kind string, userID uint, sha string, now time.Time, suffix, ext string) string {
+	name := sha[:32]
+	if userID != 0 {
+		name = fmt.Sprintf("%d_%s", userID, name)
+	}
+	return fmt.Sprintf("%s/%s/%s%s%s", kind, now.Format("200601"), name, suffix, ext)
+}
+
+// findMedia 查询同类型、同用户、同内容的已有记录
+func findMedia(kind string, userID uint, sha string) (*db.Media, bool) {
+	var media db.Media
+	if db.GetDB().Where("kind = ? AND user_id = ? AND sha256 = ?", kind, userID, sha).First(&media).Error != nil {
+		return nil, false
+	}
+	return &media, true
+}
+
+// deleteUnreferencedMedia 删除保存失败的文件；路径由内容决定，可能已被并发上传的记录引用，确认没有记录引用时才删除
+func deleteUnreferencedMedia(ctx context.Context, store Storage, keys ...string) {
+	var refs int64
+	if db.GetDB().Model(&db.Media{}).Where("`key` IN ? OR thumb_key IN ?", keys, keys).Count(&refs).Error != nil || refs > 0 {
+		return
+	}
+	for _, key := range keys {
+		store.Delete(ctx, key)
+	}
+}
+
+// saveMedia 处理并保存上传的图片，同类型、同用户、同内容的文件直接复用已有记录
+// 并发上传同一文件时由唯一索引保证只有一条记录，其余请求复用该记录
+func saveMedia(ctx context.Context, kind string, userID uint, data []byte) (*db.Media, error) {
+	sha := sha256Hex(data)
+	if existing, ok := findMedia(kind, userID, sha); ok {
+		return existing, nil
+	}
+	img, err := processImage(data)
+	if err != nil {
+		return nil, err
+	}
+	store := getStorage()
+	now := time.Now()
+	key := mediaKey(kind, userID, sha, now, "", img.Ext)
+	thumbKey := mediaKey(kind, userID, sha, now, "_thumb", allowedImageTypes[img.ThumbMime])
+	if err := store.Put(ctx, key, img.Data, img.MimeType); err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, thumbKey, img.Thumb, img.ThumbMime); err != nil {
+		deleteUnreferencedMedia(ctx, store, key)
+		return nil, err
+	}
+	media := db.Media{
+		Kind: kind, UserID: userID, Storage: store.Name(),
+		Key: key, ThumbKey: thumbKey, URL: store.URL(key), ThumbURL: store.URL(thumbKey),
+		MimeType: img.MimeType, Size: int64(len(img.Data)), Width: img.Width, Height: img.Height, SHA256: sha,
+	}
+	result := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&media)
+	if result.Error != nil {
+		deleteUnreferencedMedia(ctx, store, key, thumbKey)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if existing, ok := findMedia(kind, userID, sha); ok {
+			return existing, nil
+		}
+		return nil, errors.New("media conflict")
+	}
+	return &media, nil
+}
+
+// readUploadFile 读取 multipart 的 file 字段，超过 UploadMaxBytes 返回 413；失败时已写入响应
+func readUploadFile(c *gin.Context) ([]byte, bool) {
+	// 预留 multipart 边界及其他字段的空间
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, common.UploadMaxBytes+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(413, gin.H{"error": "file too large"})
+		} else {
+			c.JSON(400, gin.H{"error": "file required"})
+		}
+		return nil, false
+	}
+	if fh.Size > common.UploadMaxBytes {
+		c.JSON(413, gin.H{"error": "file too large"})
+		return nil, false
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file required"})
+		return nil, false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, common.UploadMaxBytes+1))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "read file failed"})
+		return nil, false
+	}
+	if int64(len(data)) > common.UploadMaxBytes {
+		c.JSON(413, gin.H{"error": "file too large"})
+		return nil, false
+	}
+	return data, true
+}
+
+// respondMediaError 图片处理或存储失败的响应
+func respondMediaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedImage):
+		c.JSON(415, gin.H{"error": "only jpeg/png/gif/webp images are allowed"})
+	case errors.Is(err, errImageTooLarge):
+		c.JSON(400, gin.H{"error": err.Error()})
+	default:
+		log.Printf("save media failed: %v", err)
+		c.JSON(500, gin.H{"error": "save file failed"})
+	}
+}
+
+// UploadMediaHandler 管理员上传文章图片（multipart 字段 file），返回图片及缩略图地址
+func UploadMediaHandler(c *gin.Context) {
+	data, ok := readUploadFile(c)
+	if !ok {
+		return
+	}
+	media, err := saveMedia(c.Request.Context(), MediaKindArticle, 0, data)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+	c.JSON(200, media)
+}
+
+// UploadAvatarHandler 用户上传头像（multipart 字段 file 和 openid）
+func UploadAvatarHandler(c *gin.Context) {
+	data, ok := readUploadFile(c)
+	if !ok {
+		return
+	}
+	openid := c.PostForm("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	userID := lookupUserID(openid)
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	media, err := saveMedia(c.Request.Context(), MediaKindAvatar, userID, data)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+	if err := db.GetDB().Model(&db.User{}).Where("id = ?", userID).Update("avatar", media.ThumbURL).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"avatar": media.ThumbURL, "media": media})
+}
@@ -0,0 +1,135 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试 Signature V4 签名密钥派生（AWS 文档示例）
+func TestSigV4SigningKey(t *testing.T) {
+	key := sigV4SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	assert.Equal(t, "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9", hex.EncodeToString(key))
+}
+
+// 测试本地存储写入、访问地址、删除及非法路径
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s := &localStorage{dir: dir, baseURL: "/uploads/"}
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "article/202601/abc.png", []byte("data"), "image/png"))
+	got, err := os.ReadFile(filepath.Join(dir, "article", "202601", "abc.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(got))
+	assert.Equal(t, "/uploads/article/202601/abc.png", s.URL("article/202601/abc.png"))
+
+	require.NoError(t, s.Delete(ctx, "article/202601/abc.png"))
+	require.NoError(t, s.Delete(ctx, "article/202601/abc.png"))
+	assert.Error(t, s.Put(ctx, "../escape.png", []byte("x"), "image/png"))
+}
+
+// 测试 S3 兼容存储：用模拟的 MinIO 服务校验签名头和内容哈希
+func TestS3Storage(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+			w.WriteHeader(403)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("x-amz-content-sha256") != sha256Hex(body) {
+			w.WriteHeader(400)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(204)
+		}
+	}))
+	defer server.Close()
+
+	s := &s3Storage{endpoint: server.URL, region: "us-east-1", bucket: "media", accessKey: "minio", secretKey: "minio123", client: server.Client()}
+	ctx := context.Background()
+	require.NoError(t, s.Put(ctx, "avatar/202601/a.jpg", []byte("jpeg"), "image/jpeg"))
+	assert.Equal(t, "jpeg", string(objects["/media/avatar/202601/a.jpg"]))
+	assert.Equal(t, server.URL+"/media/avatar/202601/a.jpg", s.URL("avatar/202601/a.jpg"))
+	require.NoError(t, s.Delete(ctx, "avatar/202601/a.jpg"))
+	assert.Empty(t, objects)
+
+	s.publicURL = "https://cdn.example.com/"
+	assert.Equal(t, "https://cdn.example.com/avatar/202601/a.jpg", s.URL("avatar/202601/a.jpg"))
+
+	bad := &s3Storage{endpoint: server.URL, region: "us-east-1", bucket: "media", accessKey: "other", secretKey: "x", client: server.Client()}
+	assert.Error(t, bad.Put(ctx, "a.jpg", []byte("x"), "image/jpeg"))
+}
+
+// 测试签名结果固定：同一请求同一时间签名一致
+func TestS3SignDeterministic(t *testing.T) {
+	s := &s3Storage{region: "us-east-1", accessKey: "ak", secretKey: "sk"}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	sign := func() string {
+		req, _ := http.NewRequest(http.MethodPut, "http://minio:9000/media/a.png", nil)
+		s.sign(req, []byte("x"), now)
+		return req.Header.Get("Authorization")
+	}
+	first := sign()
+	assert.Equal(t, first, sign())
+	assert.Contains(t, first, "Credential=ak/20260102/us-east-1/s3/aws4_request")
+	assert.Contains(t, first, "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+}
+
+// 测试图片处理：超大图片按长边缩小并生成缩略图，非图片内容被拒绝
+func TestProcessImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3000, 1000))
+	for x := 0; x < 3000; x++ {
+		src.Set(x, x%1000, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := processImage(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.MimeType)
+	assert.Equal(t, ".png", img.Ext)
+	assert.Equal(t, 1920, img.Width)
+	assert.Equal(t, 640, img.Height)
+	thumb, _, err := image.DecodeConfig(bytes.NewReader(img.Thumb))
+	require.NoError(t, err)
+	assert.Equal(t, 320, thumb.Width)
+	assert.Equal(t, 106, thumb.Height)
+
+	_, err = processImage([]byte("<html>not an image</html>"))
+	assert.ErrorIs(t, err, errUnsupportedImage)
+}
+
+// 测试头像的存储路径包含用户ID，不同用户上传相同图片不共用文件
+func TestMediaKey(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	now := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "article/202503/"+sha[:32]+".jpg", mediaKey(MediaKindArticle, 0, sha, now, "", ".jpg"))
+	assert.Equal(t, "avatar/202503/7_"+sha[:32]+"_thumb.png", mediaKey(MediaKindAvatar, 7, sha, now, "_thumb", ".png"))
+	assert.NotEqual(t, mediaKey(MediaKindAvatar, 7, sha, now, "", ".jpg"), mediaKey(MediaKindAvatar, 8, sha, now, "", ".jpg"))
+}
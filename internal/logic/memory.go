@@ -0,0 +1,219 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 记忆分类
+var memoryCategories = map[string]string{
+	"trigger": "诱因",
+	"goal":    "目标",
+	"coping":  "有效的应对方法",
+	"other":   "其他",
+}
+
+const (
+	MaxMemoryLength        = 64 // 单条记忆最大字数
+	MemoryMinMessageLength = 6  // 用户消息少于该字数时不提取记忆
+	memoryExtractTimeout   = 30 * time.Second
+)
+
+const memoryExtractPrompt = `你负责从戒瘾咨询对话中提取关于用户的长期稳定事实，供以后的对话参考。
+只提取用户明确说出的、长期有效的信息：诱因(trigger)、目标(goal)、对其有效的应对方法(coping)、其他重要背景(other)。
+不要提取一次性的情绪、寒暄、咨询师的建议，也不要重复已有记忆。每条不超过30字，用第三人称陈述。
+已有记忆：
+%s
+只输出JSON数组，没有可提取的内容时输出 []，格式：[{"category":"trigger","content":"深夜独处刷手机时容易冲动"}]`
+
+// memoryCandidate 模型提取出的候选记忆
+type memoryCandidate struct {
+	Category string `json:"category"`
+	Content  string `json:"content"`
+}
+
+// normalizeMemory 去除空白和标点后用于判重
+func normalizeMemory(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// parseMemoryCandidates 解析模型输出，丢弃分类非法、为空或过长的条目并去重
+func parseMemoryCandidates(output string) []memoryCandidate {
+	start, end := strings.Index(output, "["), strings.LastIndex(output, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+	var raw []memoryCandidate
+	if err := json.Unmarshal([]byte(output[start:end+1]), &raw); err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var candidates []memoryCandidate
+	for _, m := range raw {
+		m.Category = strings.TrimSpace(m.Category)
+		m.Content = strings.TrimSpace(m.Content)
+		key := normalizeMemory(m.Content)
+		if _, ok := memoryCategories[m.Category]; !ok || key == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(m.Content) > MaxMemoryLength {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, m)
+	}
+	return candidates
+}
+
+// extractUserMemories 从一轮对话中提取新记忆并保存，超出上限时删除最早的记忆
+func extractUserMemories(ctx context.Context, p LLMProvider, userID uint, msgID, userMsg, reply string) error {
+	var existing []db.UserMemory
+	db.GetDB().Where("user_id = ?", userID).Order("id asc").Find(&existing)
+	known := map[string]bool{}
+	var lines []string
+	for _, m := range existing {
+		known[normalizeMemory(m.Content)] = true
+		lines = append(lines, "- "+m.Content)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "（无）")
+	}
+
+	res, err := p.Chat(ctx, LLMRequest{Messages: []LLMMessage{
+		{Role: "system", Content: fmt.Sprintf(memoryExtractPrompt, strings.Join(lines, "\n"))},
+		{Role: "user", Content: "用户：" + userMsg + "\n咨询师：" + reply},
+	}}, nil)
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for _, m := range parseMemoryCandidates(res.Content) {
+		if known[normalizeMemory(m.Content)] {
+			continue
+		}
+		memory := db.UserMemory{UserID: userID, Category: m.Category, Content: m.Content, SourceMsgID: msgID}
+		if err := db.GetDB().Create(&memory).Error; err != nil {
+			return err
+		}
+		added++
+	}
+	if overflow := len(existing) + added - common.MemoryMaxPerUser; added > 0 && overflow > 0 {
+		var oldest []uint
+		db.GetDB().Model(&db.UserMemory{}).Where("user_id = ?", userID).Order("id asc").Limit(overflow).Pluck("id", &oldest)
+		db.GetDB().Delete(&db.UserMemory{}, oldest)
+	}
+	return nil
+}
+
+// extractUserMemoriesAsync 对话结束后异步提取记忆，不影响回复
+func extractUserMemoriesAsync(userID uint, msgID, userMsg, reply string) {
+	if !common.MemoryEnabled || utf8.RuneCountInString(userMsg) < MemoryMinMessageLength || reply == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(withUsageMeta(context.Background(), userID, msgID, "memory"), memoryExtractTimeout)
+		defer cancel()
+		if err := extractUserMemories(ctx, getAIProvider(), userID, msgID, userMsg, reply); err != nil {
+			log.Printf("[Memory] user %d 提取记忆失败: %v", userID, err)
+		}
+	}()
+}
+
+// formatUserMemories 渲染注入对话上下文的记忆，按最新优先截取，总字数不超过 maxRunes
+func formatUserMemories(memories []db.UserMemory, maxRunes int) string {
+	header := "以下是此前对话中记录的用户长期信息，供参考，不要向用户逐条复述：\n"
+	var sb strings.Builder
+	used := 0
+	for _, m := range memories {
+		line := fmt.Sprintf("- [%s] %s\n", memoryCategories[m.Category], m.Content)
+		n := utf8.RuneCountInString(line)
+		if used+n > maxRunes {
+			break
+		}
+		sb.WriteString(line)
+		used += n
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return header + sb.String()
+}
+
+// loadUserMemoryContext 加载用户记忆并渲染为系统消息内容，没有记忆时返回空
+func loadUserMemoryContext(userID uint) string {
+	if common.MemoryContextMaxRunes == 0 {
+		return ""
+	}
+	var memories []db.UserMemory
+	db.GetDB().Where("user_id = ?", userID).Order("updated_at desc").Limit(common.MemoryMaxPerUser).Find(&memories)
+	return formatUserMemories(memories, common.MemoryContextMaxRunes)
+}
+
+// ListMemoriesHandler 查看自己的长期记忆
+func ListMemoriesHandler(c *gin.Context) {
+	openid := c.Query("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	var user db.User
+	if err := db.GetDB().Where("open_id = ?", openid).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	var memories []db.UserMemory
+	db.GetDB().Where("user_id = ?", user.ID).Order("updated_at desc").Find(&memories)
+	c.JSON(200, gin.H{"memories": memories})
+}
+
+// DeleteMemoryHandler 删除一条记忆；id 为 all 时清空全部记忆
+func DeleteMemoryHandler(c *gin.Context) {
+	openid := c.Query("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	var user db.User
+	if err := db.GetDB().Where("open_id = ?", openid).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	query := db.GetDB().Where("user_id = ?", user.ID)
+	if idParam := c.Param("id"); idParam != "all" {
+		id, err := strconv.ParseUint(idParam, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid memory ID"})
+			return
+		}
+		query = query.Where("id = ?", id)
+	}
+	result := query.Delete(&db.UserMemory{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	if result.RowsAffected == 0 && c.Param("id") != "all" {
+		c.JSON(404, gin.H{"error": "memory not found"})
+		return
+	}
+	c.JSON(200, gin.H{"deleted": result.RowsAffected})
+}
@@ -0,0 +1,45 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试解析模型提取的候选记忆
+func TestParseMemoryCandidates(t *testing.T) {
+	out := "好的：\n" + `[{"category":"trigger","content":"深夜独处刷手机时容易冲动"},` +
+		`{"category":"trigger","content":"深夜独处，刷手机时容易冲动。"},` +
+		`{"category":"mood","content":"今天很烦"},` +
+		`{"category":"goal","content":"  "},` +
+		`{"category":"coping","content":"冲动时出门跑步有效"}]`
+	got := parseMemoryCandidates(out)
+	assert.Equal(t, []memoryCandidate{
+		{Category: "trigger", Content: "深夜独处刷手机时容易冲动"},
+		{Category: "coping", Content: "冲动时出门跑步有效"},
+	}, got)
+
+	assert.Nil(t, parseMemoryCandidates("没有可提取的内容"))
+	assert.Empty(t, parseMemoryCandidates("[]"))
+}
+
+// 测试注入上下文的记忆受字数上限约束
+func TestFormatUserMemories(t *testing.T) {
+	memories := []db.UserMemory{
+		{Category: "goal", Content: "希望坚持满90天"},
+		{Category: "coping", Content: "冲动时出门跑步有效"},
+	}
+	out := formatUserMemories(memories, 100)
+	assert.Contains(t, out, "- [目标] 希望坚持满90天")
+	assert.Contains(t, out, "- [有效的应对方法] 冲动时出门跑步有效")
+
+	out = formatUserMemories(memories, 16)
+	assert.Contains(t, out, "希望坚持满90天")
+	assert.False(t, strings.Contains(out, "跑步"))
+
+	assert.Equal(t, "", formatUserMemories(memories, 5))
+	assert.Equal(t, "", formatUserMemories(nil, 100))
+}
@@ -3,11 +3,11 @@ package logic
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"time"
+	"net/url"
 
 	"jieyou-backend/internal/common"
 )
@@ -35,103 +35,87 @@ type WxTemplateResponse struct {
 	MsgID   int64  `json:"msgid"`
 }
 
-var (
-	accessToken     string
-	accessTokenTime time.Time
-	tokenExpiresIn  int
+// WxAPIError 微信接口返回的错误码
+type WxAPIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *WxAPIError) Error() string {
+	return fmt.Sprintf("%d - %s", e.Code, e.Msg)
+}
+
+// 微信订阅消息错误码
+const (
+	WxErrSystemBusy         = -1    // 系统繁忙
+	WxErrInvalidCredential  = 40001 // access_token 无效或已被其他实例刷新
+	WxErrInvalidAccessToken = 40014 // 不合法的 access_token
+	WxErrAccessTokenExpired = 42001 // access_token 已过期
+	WxErrAPILimit           = 45009 // 接口调用超过每日限额
+	WxErrFreqLimit          = 45011 // 接口调用过于频繁
+	WxErrUserRefused        = 43101 // 用户拒绝接受消息，或一次性订阅次数已用完
 )
 
 // GetWxAccessToken 获取微信access token
 func GetWxAccessToken() (string, error) {
-	// 检查token是否过期（提前5分钟刷新）
-	if accessToken != "" && time.Now().Before(accessTokenTime.Add(time.Duration(tokenExpiresIn-300)*time.Second)) {
-		return accessToken, nil
-	}
-
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s",
-		common.WxAPPID, common.WxAPPSecret)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("获取access token失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %v", err)
-	}
-
-	var tokenResp WxAccessTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", fmt.Errorf("解析响应失败: %v", err)
-	}
+	return getWxTokenManager().Token()
+}
 
-	if tokenResp.ErrCode != 0 {
-		return "", fmt.Errorf("微信API错误: %d - %s", tokenResp.ErrCode, tokenResp.ErrMsg)
+// stripRequestURL 去掉请求错误中的URL，其中的 access_token、secret 不能写入日志和发送记录
+func stripRequestURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
 	}
-
-	accessToken = tokenResp.AccessToken
-	accessTokenTime = time.Now()
-	tokenExpiresIn = tokenResp.ExpiresIn
-
-	log.Printf("获取新的access token成功，过期时间: %d秒", tokenExpiresIn)
-	return accessToken, nil
+	return err
 }
 
-// SendTemplateMessage 发送模板消息
-func SendTemplateMessage(openID, page string, data map[string]interface{}) error {
+// SendTemplateMessage 发送订阅消息，成功时返回微信的消息ID
+func SendTemplateMessage(openID, templateID, page string, data map[string]interface{}) (int64, error) {
 	token, err := GetWxAccessToken()
 	if err != nil {
-		return fmt.Errorf("获取access token失败: %v", err)
+		return 0, fmt.Errorf("获取access token失败: %v", err)
 	}
 
-	url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/message/subscribe/send?access_token=%s", token)
+	endpoint := fmt.Sprintf("%s/cgi-bin/message/subscribe/send?access_token=%s", common.WxAPIBaseURL, token)
 
 	message := WxTemplateMessage{
 		Touser:     openID,
-		TemplateID: common.WxTemplateID,
+		TemplateID: templateID,
 		Page:       page,
 		Data:       data,
 	}
 
 	jsonData, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("序列化消息失败: %v", err)
+		return 0, fmt.Errorf("序列化消息失败: %v", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := wxHTTPClient.Post(endpoint, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("发送请求失败: %v", err)
+		return 0, fmt.Errorf("发送请求失败: %v", stripRequestURL(err))
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("读取响应失败: %v", err)
+		return 0, fmt.Errorf("读取响应失败: %v", err)
 	}
 
 	var templateResp WxTemplateResponse
 	if err := json.Unmarshal(body, &templateResp); err != nil {
-		return fmt.Errorf("解析响应失败: %v", err)
+		return 0, fmt.Errorf("解析响应失败: %v", err)
 	}
 
 	if templateResp.ErrCode != 0 {
-		return fmt.Errorf("发送模板消息失败: %d - %s", templateResp.ErrCode, templateResp.ErrMsg)
+		switch templateResp.ErrCode {
+		case WxErrInvalidCredential, WxErrInvalidAccessToken, WxErrAccessTokenExpired:
+			// 令牌已被其他实例刷新或过期，下次发送时强制刷新
+			getWxTokenManager().Invalidate(token)
+		}
+		return 0, fmt.Errorf("发送模板消息失败: %w", &WxAPIError{Code: templateResp.ErrCode, Msg: templateResp.ErrMsg})
 	}
 
 	log.Printf("发送模板消息成功，消息ID: %d", templateResp.MsgID)
-	return nil
-}
-
-// SendSignInReminder 发送打卡提醒
-func SendSignInReminder(openID, nickname string) error {
-	data := map[string]interface{}{
-		"thing1": map[string]string{"value": "打卡提醒"},                                   // 标题
-		"thing2": map[string]string{"value": "今日尚未打卡"},                                 // 内容
-		"time3":  map[string]string{"value": time.Now().Format("2006-01-02 15:04:05")}, // 时间
-		"thing4": map[string]string{"value": "请及时完成今日打卡，以保持进度"},                        // 备注
-	}
-
-	return SendTemplateMessage(openID, "pages/index/index", data)
+	return templateResp.MsgID, nil
 }
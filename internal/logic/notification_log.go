@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 订阅消息发送结果
+const (
+	NotifyOutcomeSent         = "sent"          // 发送成功
+	NotifyOutcomeRefused      = "refused"       // 用户拒收或次数已用完，清空订阅次数
+	NotifyOutcomeTokenInvalid = "token_invalid" // access token 失效，刷新后重试
+	NotifyOutcomeThrottled    = "throttled"     // 微信限流或系统繁忙，稍后重试
+	NotifyOutcomeFailed       = "failed"        // 模板、参数等错误，重试无意义
+	NotifyOutcomeError        = "error"         // 网络等未知错误，稍后重试
+)
+
+var notifyOutcomes = map[string]bool{
+	NotifyOutcomeSent:         true,
+	NotifyOutcomeRefused:      true,
+	NotifyOutcomeTokenInvalid: true,
+	NotifyOutcomeThrottled:    true,
+	NotifyOutcomeFailed:       true,
+	NotifyOutcomeError:        true,
+}
+
+// classifyNotifyError 按微信错误码归类发送结果
+func classifyNotifyError(err error) string {
+	if err == nil {
+		return NotifyOutcomeSent
+	}
+	var wxErr *WxAPIError
+	if !errors.As(err, &wxErr) {
+		return NotifyOutcomeError
+	}
+	switch wxErr.Code {
+	case WxErrUserRefused:
+		return NotifyOutcomeRefused
+	case WxErrInvalidCredential, WxErrInvalidAccessToken, WxErrAccessTokenExpired:
+		return NotifyOutcomeTokenInvalid
+	case WxErrSystemBusy, WxErrAPILimit, WxErrFreqLimit:
+		return NotifyOutcomeThrottled
+	default:
+		return NotifyOutcomeFailed
+	}
+}
+
+// notifyRetryable 该结果是否值得重试
+func notifyRetryable(outcome string) bool {
+	switch outcome {
+	case NotifyOutcomeTokenInvalid, NotifyOutcomeThrottled, NotifyOutcomeError:
+		return true
+	}
+	return false
+}
+
+// recordNotification 保存一次发送记录，失败只打日志
+func recordNotification(n *db.Notification, err error) {
+	n.Outcome = classifyNotifyError(err)
+	if err != nil {
+		var wxErr *WxAPIError
+		if errors.As(err, &wxErr) {
+			n.ErrCode = wxErr.Code
+		}
+		n.ErrMsg = truncateRunes(err.Error(), 255)
+	}
+	if db.GetDB() == nil {
+		return
+	}
+	if dbErr := db.GetDB().Create(n).Error; dbErr != nil {
+		log.Printf("保存通知发送记录失败: %v", dbErr)
+	}
+}
+
+// deliverNotification 调用微信接口发送订阅消息并记录每次尝试，base 提供记录的用户、模板等字段
+// 令牌失效时刷新令牌后立即重试，限流和网络错误从 NotifyRetryBackoff 开始指数退避后重试，最多 NotifyMaxAttempts 次
+func deliverNotification(base db.Notification, data map[string]interface{}) error {
+	payload, _ := json.Marshal(data)
+	base.Payload = string(payload)
+	var err error
+	for attempt := 1; attempt <= common.NotifyMaxAttempts; attempt++ {
+		n := base
+		n.Attempt = attempt
+		n.MsgID, err = SendTemplateMessage(n.OpenID, n.TemplateID, n.Page, data)
+		recordNotification(&n, err)
+		if !notifyRetryable(n.Outcome) || attempt == common.NotifyMaxAttempts {
+			break
+		}
+		if n.Outcome == NotifyOutcomeTokenInvalid {
+			// SendTemplateMessage 已将旧令牌标记失效，立即用新令牌重试
+			continue
+		}
+		time.Sleep(common.NotifyRetryBackoff << (attempt - 1))
+	}
+	return err
+}
+
+// notificationQuery 按查询参数过滤发送记录：user_id、openid、kind、outcome、errcode、from、to
+func notificationQuery(c *gin.Context) (*gorm.DB, bool) {
+	var userID uint64
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		userID = id
+	}
+	outcome := c.Query("outcome")
+	if outcome != "" && !notifyOutcomes[outcome] {
+		return nil, false
+	}
+	errCode, hasErrCode := 0, false
+	if v := c.Query("errcode"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false
+		}
+		errCode, hasErrCode = code, true
+	}
+	from, to, ok := usageDateRange(c)
+	if !ok {
+		return nil, false
+	}
+
+	query := db.GetDB().Model(&db.Notification{}).Where("created_at >= ? AND created_at < ?", from, to)
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if openid := c.Query("openid"); openid != "" {
+		query = query.Where("open_id = ?", openid)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+	if hasErrCode {
+		query = query.Where("err_code = ?", errCode)
+	}
+	return query, true
+}
+
+// ListNotificationsHandler 分页查询订阅消息发送记录
+func ListNotificationsHandler(c *gin.Context) {
+	query, ok := notificationQuery(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid query"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	var total int64
+	query.Count(&total)
+	var notifications []db.Notification
+	if err := query.Order("id desc").Offset((page - 1) * size).Limit(size).Find(&notifications).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "page": page, "notifications": notifications})
+}
+
+// NotificationStatsHandler 按通知类型和发送结果统计，支持与列表相同的过滤参数
+func NotificationStatsHandler(c *gin.Context) {
+	query, ok := notificationQuery(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid query"})
+		return
+	}
+	type Result struct {
+		Kind    string `json:"kind"`
+		Outcome string `json:"outcome"`
+		Count   int64  `json:"count"`
+	}
+	var results []Result
+	if err := query.Select("kind, outcome, COUNT(*) AS count").
+		Group("kind, outcome").Order("kind, outcome").Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"stats": results})
+}
@@ -1,10 +1,17 @@
 package logic
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
 )
 
 // 测试微信访问令牌响应结构
@@ -151,3 +158,93 @@ func TestOpenIDValidation(t *testing.T) {
 		assert.True(t, openid == "" || len(openid) <= 5, "OpenID应该无效: %s", openid)
 	}
 }
+
+// 测试微信错误码可通过 errors.As 取出
+func TestWxAPIErrorUnwrap(t *testing.T) {
+	err := fmt.Errorf("发送模板消息失败: %w", &WxAPIError{Code: WxErrUserRefused, Msg: "user refuse to accept the msg"})
+	var wxErr *WxAPIError
+	assert.True(t, errors.As(err, &wxErr))
+	assert.Equal(t, WxErrUserRefused, wxErr.Code)
+	assert.Contains(t, err.Error(), "43101")
+}
+
+// 测试订阅授权只接受已配置模板的有效状态
+func TestSubscriptionAuthInvalidResults(t *testing.T) {
+	router := setupTestRouter()
+	for _, body := range []string{
+		`{"openid":"u1","results":{"unknown_tpl":"accept"}}`,
+		`{"openid":"u1","results":{"test_template_id":"maybe","errMsg":"requestSubscribeMessage:ok"}}`,
+		`{"openid":"u1","templateId":"unknown_tpl"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/subscription/auth", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code, body)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/subscription/credits", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+// 测试按微信错误码归类发送结果
+func TestClassifyNotifyError(t *testing.T) {
+	wrap := func(code int) error {
+		return fmt.Errorf("发送模板消息失败: %w", &WxAPIError{Code: code, Msg: "x"})
+	}
+	assert.Equal(t, NotifyOutcomeSent, classifyNotifyError(nil))
+	assert.Equal(t, NotifyOutcomeRefused, classifyNotifyError(wrap(WxErrUserRefused)))
+	assert.Equal(t, NotifyOutcomeTokenInvalid, classifyNotifyError(wrap(WxErrInvalidCredential)))
+	assert.Equal(t, NotifyOutcomeTokenInvalid, classifyNotifyError(wrap(WxErrAccessTokenExpired)))
+	assert.Equal(t, NotifyOutcomeThrottled, classifyNotifyError(wrap(WxErrFreqLimit)))
+	assert.Equal(t, NotifyOutcomeThrottled, classifyNotifyError(wrap(WxErrSystemBusy)))
+	assert.Equal(t, NotifyOutcomeFailed, classifyNotifyError(wrap(47003)))
+	assert.Equal(t, NotifyOutcomeError, classifyNotifyError(errors.New("发送请求失败: timeout")))
+
+	assert.True(t, notifyRetryable(NotifyOutcomeTokenInvalid))
+	assert.True(t, notifyRetryable(NotifyOutcomeThrottled))
+	assert.False(t, notifyRetryable(NotifyOutcomeRefused))
+	assert.False(t, notifyRetryable(NotifyOutcomeFailed))
+}
+
+// 测试发送记录查询参数校验
+func TestListNotificationsInvalid(t *testing.T) {
+	router := setupTestRouter()
+	common.AdminToken = "secret"
+	defer func() { common.AdminToken = "" }()
+	for _, query := range []string{
+		"user_id=abc",
+		"outcome=unknown",
+		"errcode=x",
+		"from=2025/01/01",
+	} {
+		for _, path := range []string{"/api/admin/notifications", "/api/admin/notifications/stats"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path+"?"+query, nil)
+			req.Header.Set("X-Admin-Token", "secret")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, 400, w.Code, path+"?"+query)
+		}
+	}
+}
+
+// 测试请求失败的错误信息不包含带 access_token 的URL
+func TestSendTemplateMessageHidesToken(t *testing.T) {
+	srv, _, _ := fakeWxServer(t)
+	_, err := GetWxAccessToken()
+	assert.NoError(t, err)
+	srv.Close()
+	_, err = SendTemplateMessage("u1", "tpl", "", map[string]interface{}{})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "access_token")
+	assert.NotContains(t, err.Error(), "token-1")
+	assert.Contains(t, err.Error(), "发送请求失败")
+
+	// 获取令牌失败时不包含 secret
+	SetWxTokenManager(newWxTokenManager(&memoryTokenStore{}))
+	_, err = SendTemplateMessage("u1", "tpl", "", map[string]interface{}{})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	assert.NotContains(t, err.Error(), common.WxAPPSecret)
+}
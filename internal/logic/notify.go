@@ -0,0 +1,327 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 通知类型，对应 common.NotifyTemplates 的 key
+const (
+	NotifyCheckInReminder = "checkin_reminder"
+	NotifyMilestone       = "milestone"
+	NotifyRelapseSupport  = "relapse_support"
+	NotifyWeeklyReport    = "weekly_report"
+	NotifyNewArticle      = "new_article"
+)
+
+var errTemplateDisabled = errors.New("notify template not configured")
+
+// notifyTemplate 获取通知类型的模板配置，未配置模板ID时返回 false
+func notifyTemplate(kind string) (common.NotifyTemplateConfig, bool) {
+	cfg, ok := common.NotifyTemplates[kind]
+	return cfg, ok && cfg.TemplateID != ""
+}
+
+// NotifyTemplateInfo 小程序请求订阅时使用的模板
+type NotifyTemplateInfo struct {
+	Kind       string `json:"kind"`
+	TemplateID string `json:"template_id"`
+}
+
+// enabledNotifyTemplates 已配置模板ID的通知类型，按类型名排序
+func enabledNotifyTemplates() []NotifyTemplateInfo {
+	var out []NotifyTemplateInfo
+	for kind := range common.NotifyTemplates {
+		if cfg, ok := notifyTemplate(kind); ok {
+			out = append(out, NotifyTemplateInfo{Kind: kind, TemplateID: cfg.TemplateID})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kind < out[j].Kind })
+	return out
+}
+
+// 订阅消息关键词的取值规则
+var (
+	wxNumberRe      = regexp.MustCompile(`^\d+(\.\d+)?$`)
+	wxLetterRe      = regexp.MustCompile(`^[A-Za-z]+$`)
+	wxCharStringRe  = regexp.MustCompile(`^[\x21-\x7e]+$`)
+	wxAmountRe      = regexp.MustCompile(`^[¥$€£]?\d{1,10}(\.\d{1,2})?元?$`)
+	wxPhoneNumberRe = regexp.MustCompile(`^[0-9+\-() ]+$`)
+	wxTimeLayouts   = []string{
+		"15:04", "2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05",
+		"2006年1月2日", "2006年1月2日 15:04", "2006年01月02日", "2006年01月02日 15:04",
+	}
+)
+
+// maxThingRunes thing 类型关键词的最大长度
+const maxThingRunes = 20
+
+// validateTemplateValue 按微信订阅消息关键词类型（thing1 的类型为 thing）校验取值
+func validateTemplateValue(keyword, value string) error {
+	typ := strings.TrimRight(keyword, "0123456789")
+	n := utf8.RuneCountInString(value)
+	if n == 0 {
+		return fmt.Errorf("%s: empty value", keyword)
+	}
+	valid := true
+	switch typ {
+	case "thing":
+		valid = n <= maxThingRunes
+	case "number":
+		valid = n <= 32 && wxNumberRe.MatchString(value)
+	case "letter":
+		valid = n <= 32 && wxLetterRe.MatchString(value)
+	case "symbol":
+		valid = n <= 5 && !strings.ContainsAny(value, "0123456789") && !wxLetterRe.MatchString(value)
+	case "character_string":
+		valid = n <= 32 && wxCharStringRe.MatchString(value)
+	case "time", "date":
+		valid = false
+		for _, layout := range wxTimeLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				valid = true
+				break
+			}
+		}
+	case "amount":
+		valid = wxAmountRe.MatchString(value)
+	case "phone_number":
+		valid = n <= 17 && wxPhoneNumberRe.MatchString(value)
+	case "car_number":
+		valid = n <= 8
+	case "name":
+		// 中文姓名最多10个字，纯字母最多20个
+		valid = n <= 10 || (n <= 20 && len(value) == n)
+	case "phrase":
+		valid = n <= 5
+	default:
+		return fmt.Errorf("%s: unknown keyword type", keyword)
+	}
+	if !valid {
+		return fmt.Errorf("%s: invalid value %q", keyword, value)
+	}
+	return nil
+}
+
+// buildTemplateData 按模板的字段映射生成订阅消息 data，thing 类型超长时截断
+func buildTemplateData(cfg common.NotifyTemplateConfig, values map[string]string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for field, keyword := range cfg.Fields {
+		value := strings.TrimSpace(values[field])
+		if value == "" {
+			return nil, fmt.Errorf("missing field %s", field)
+		}
+		if strings.HasPrefix(keyword, "thing") && utf8.RuneCountInString(value) > maxThingRunes {
+			value = truncateRunes(value, maxThingRunes-1) + "…"
+		}
+		if err := validateTemplateValue(keyword, value); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		data[keyword] = map[string]string{"value": value}
+	}
+	return data, nil
+}
+
+// sendNotification 发送发送队列中的一条通知，pageQuery 追加到跳转页面（如 "id=1"），发送记录关联 outboxID
+func sendNotification(user db.User, kind string, values map[string]string, pageQuery string, outboxID uint) error {
+	cfg, ok := notifyTemplate(kind)
+	if !ok {
+		return errTemplateDisabled
+	}
+	data, err := buildTemplateData(cfg, values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+	page := cfg.Page
+	if pageQuery != "" {
+		page += "?" + pageQuery
+	}
+	return deliverNotification(db.Notification{
+		UserID: user.ID, OpenID: user.OpenID, Kind: kind, TemplateID: cfg.TemplateID, Page: page, OutboxID: outboxID,
+	}, data)
+}
+
+// checkInReminderValues 每日打卡提醒的内容
+func checkInReminderValues() map[string]string {
+	return map[string]string{
+		"title":   "打卡提醒",
+		"content": "今日尚未打卡",
+		"time":    time.Now().Format("2006-01-02 15:04:05"),
+		"remark":  "请及时完成今日打卡，以保持进度",
+	}
+}
+
+// scheduledReminderValues 用户预约提醒的内容
+func scheduledReminderValues(note string) map[string]string {
+	return map[string]string{
+		"title":   "预约提醒",
+		"content": note,
+		"time":    time.Now().Format("2006-01-02 15:04:05"),
+		"remark":  "坚持就是胜利，加油",
+	}
+}
+
+// enqueueMilestone 在打卡事务中调用，连续守戒天数达到里程碑时将祝贺写入发送队列，返回是否写入
+func enqueueMilestone(tx *gorm.DB, user db.User, date string) (bool, error) {
+	if _, ok := notifyTemplate(NotifyMilestone); !ok {
+		return false, nil
+	}
+	var records []db.SignRecord
+	if err := tx.Where("user_id = ?", user.ID).Order("date asc").Find(&records).Error; err != nil {
+		return false, err
+	}
+	streak := computeSignStats(records).CurrentStreak
+	for _, m := range common.Recommend.Milestones {
+		if streak != m {
+			continue
+		}
+		return enqueueNotification(tx, fmt.Sprintf("%s:%d:%s", NotifyMilestone, user.ID, date), user.ID, NotifyMilestone, map[string]string{
+			"title":  "守戒里程碑达成",
+			"days":   strconv.Itoa(m),
+			"date":   date,
+			"remark": fmt.Sprintf("已连续守戒%d天，继续保持", m),
+		}, "")
+	}
+	return false, nil
+}
+
+// enqueueRelapseSupport 在破戒事务中调用，将鼓励消息写入发送队列，返回是否写入
+func enqueueRelapseSupport(tx *gorm.DB, user db.User, date string) (bool, error) {
+	return enqueueNotification(tx, fmt.Sprintf("%s:%d:%s", NotifyRelapseSupport, user.ID, date), user.ID, NotifyRelapseSupport, map[string]string{
+		"title":   "别灰心，重新开始",
+		"content": "破戒不等于失败，复盘原因再出发",
+		"time":    time.Now().Format("2006-01-02 15:04"),
+		"remark":  "想聊聊可以随时找AI助手",
+	}, "")
+}
+
+// notifyNewArticleAsync 文章首次发布时给订阅了新文章提醒的用户写入发送队列，同一文章每人只通知一次
+// 会消耗所有订阅用户的次数，只能从管理接口和定时发布调用
+func notifyNewArticleAsync(article db.Article) {
+	cfg, ok := notifyTemplate(NotifyNewArticle)
+	if !ok {
+		return
+	}
+	go func() {
+		var userIDs []uint
+		if err := db.GetDB().Model(&db.SubscriptionCredit{}).
+			Where("template_id = ? AND credits > 0", cfg.TemplateID).Pluck("user_id", &userIDs).Error; err != nil {
+			log.Printf("获取新文章通知用户失败: %v", err)
+			return
+		}
+		category := article.Category
+		if category == "" {
+			category = "戒断知识"
+		}
+		date := time.Now().Format("2006-01-02")
+		if article.PublishedAt != nil {
+			date = article.PublishedAt.Format("2006-01-02")
+		}
+		queuedCount := 0
+		for _, userID := range userIDs {
+			queued, err := enqueueNotification(db.GetDB(), fmt.Sprintf("%s:%d:%d", NotifyNewArticle, article.ID, userID), userID, NotifyNewArticle, map[string]string{
+				"title":    article.Title,
+				"category": category,
+				"date":     date,
+			}, fmt.Sprintf("id=%d", article.ID))
+			if err != nil {
+				log.Printf("写入文章 %d 新文章通知失败: %v", article.ID, err)
+			} else if queued {
+				queuedCount++
+			}
+		}
+		if queuedCount > 0 {
+			kickOutbox()
+		}
+	}()
+}
+
+// weeklyReportDue 用户当地时间周一到达周报时间且本周未发送时返回本周一日期
+func weeklyReportDue(sub *db.Subscription, now time.Time) (time.Time, bool) {
+	_, loc := reminderSetting(sub)
+	local := now.In(loc)
+	monday := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	if local.Weekday() != time.Monday || sub.LastWeeklyReport == monday.Format("2006-01-02") {
+		return monday, false
+	}
+	t, err := time.Parse("15:04", common.WeeklyReportTime)
+	if err != nil {
+		t, _ = time.Parse("15:04", "09:00")
+	}
+	return monday, !local.Before(monday.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute))
+}
+
+// DispatchWeeklyReports 每分钟调用，周一将订阅了周报的用户上周的打卡统计写入发送队列，上周没有打卡记录的不发送
+func DispatchWeeklyReports() {
+	cfg, ok := notifyTemplate(NotifyWeeklyReport)
+	if !ok || db.GetDB() == nil {
+		return
+	}
+	var subscriptions []db.Subscription
+	if err := db.GetDB().
+		Joins("JOIN subscription_credits c ON c.user_id = subscriptions.user_id AND c.template_id = ? AND c.credits > 0", cfg.TemplateID).
+		Find(&subscriptions).Error; err != nil {
+		log.Printf("获取周报订阅用户失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range subscriptions {
+		sub := &subscriptions[i]
+		monday, due := weeklyReportDue(sub, now)
+		if !due {
+			continue
+		}
+		week := monday.Format("2006-01-02")
+		start, end := monday.AddDate(0, 0, -7).Format("2006-01-02"), monday.AddDate(0, 0, -1).Format("2006-01-02")
+		var counts []struct {
+			Type  string
+			Count int
+		}
+		db.GetDB().Model(&db.SignRecord{}).Select("type, COUNT(*) AS count").
+			Where("user_id = ? AND date BETWEEN ? AND ?", sub.UserID, start, end).Group("type").Scan(&counts)
+		signDays, breakDays := 0, 0
+		for _, c := range counts {
+			switch c.Type {
+			case "sign":
+				signDays = c.Count
+			case "break":
+				breakDays = c.Count
+			}
+		}
+		remark := "本周继续加油"
+		if breakDays == 0 {
+			remark = "上周全勤守戒，太棒了"
+		}
+		// 占用本周的周报并写入发送队列，多个实例同时调度时只有一个能写入
+		err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+			claim := tx.Model(&db.Subscription{}).
+				Where("id = ? AND (last_weekly_report IS NULL OR last_weekly_report <> ?)", sub.ID, week).
+				Update("last_weekly_report", week)
+			if claim.Error != nil || claim.RowsAffected == 0 || signDays+breakDays == 0 {
+				return claim.Error
+			}
+			_, err := enqueueNotification(tx, fmt.Sprintf("%s:%d:%s", NotifyWeeklyReport, sub.UserID, week), sub.UserID, NotifyWeeklyReport, map[string]string{
+				"period":     fmt.Sprintf("%s至%s", monday.AddDate(0, 0, -7).Format("1月2日"), monday.AddDate(0, 0, -1).Format("1月2日")),
+				"sign_days":  strconv.Itoa(signDays),
+				"break_days": strconv.Itoa(breakDays),
+				"remark":     remark,
+			}, "")
+			return err
+		})
+		if err != nil {
+			log.Printf("写入用户 %d 周报失败: %v", sub.UserID, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 测试订阅消息关键词按微信规则校验
+func TestValidateTemplateValue(t *testing.T) {
+	valid := map[string]string{
+		"thing1":            "今日尚未打卡",
+		"number2":           "30",
+		"time3":             "2025-03-10 21:00:05",
+		"date4":             "2025年3月10日",
+		"character_string5": "A-1024",
+		"amount6":           "¥12.50",
+		"phrase7":           "已完成",
+		"name8":             "小明",
+	}
+	for keyword, value := range valid {
+		assert.NoError(t, validateTemplateValue(keyword, value), keyword)
+	}
+	invalid := map[string]string{
+		"thing1":            "这是一段超过二十个字的很长很长很长很长的内容",
+		"number2":           "三十",
+		"time3":             "晚上九点",
+		"character_string5": "含中文",
+		"phrase7":           "超过五个字了",
+		"unknown1":          "x",
+	}
+	for keyword, value := range invalid {
+		assert.Error(t, validateTemplateValue(keyword, value), keyword)
+	}
+	assert.Error(t, validateTemplateValue("thing1", ""))
+}
+
+// 测试按字段映射生成模板数据，thing 超长时截断
+func TestBuildTemplateData(t *testing.T) {
+	cfg := common.NotifyTemplateConfig{
+		TemplateID: "tpl",
+		Fields:     map[string]string{"title": "thing1", "days": "number2"},
+	}
+	data, err := buildTemplateData(cfg, map[string]string{
+		"title": "一篇标题非常非常非常非常非常长的新文章发布了",
+		"days":  "7",
+		"extra": "ignored",
+	})
+	require.NoError(t, err)
+	title := data["thing1"].(map[string]string)["value"]
+	assert.Equal(t, 20, len([]rune(title)))
+	assert.Equal(t, "…", string([]rune(title)[19]))
+	assert.Equal(t, map[string]string{"value": "7"}, data["number2"])
+	assert.Len(t, data, 2)
+
+	_, err = buildTemplateData(cfg, map[string]string{"title": "标题"})
+	assert.ErrorContains(t, err, "missing field days")
+	_, err = buildTemplateData(cfg, map[string]string{"title": "标题", "days": "七"})
+	assert.Error(t, err)
+}
+
+// 测试内置通知的字段都能通过模板校验
+func TestBuiltinNotifyTemplates(t *testing.T) {
+	for _, kind := range []string{NotifyCheckInReminder, NotifyMilestone, NotifyRelapseSupport, NotifyWeeklyReport, NotifyNewArticle} {
+		_, ok := common.NotifyTemplates[kind]
+		assert.True(t, ok, kind)
+	}
+	_, err := buildTemplateData(common.NotifyTemplates[NotifyCheckInReminder], map[string]string{
+		"title": "打卡提醒", "content": "今日尚未打卡", "time": time.Now().Format("2006-01-02 15:04:05"), "remark": "请及时完成今日打卡，以保持进度",
+	})
+	assert.NoError(t, err)
+	_, err = buildTemplateData(common.NotifyTemplates[NotifyWeeklyReport], map[string]string{
+		"period": "3月3日至3月9日", "sign_days": "6", "break_days": "1", "remark": "本周继续加油",
+	})
+	assert.NoError(t, err)
+}
+
+// 测试周报只在用户当地周一到达发送时间后发送一次
+func TestWeeklyReportDue(t *testing.T) {
+	sub := &db.Subscription{Timezone: "Asia/Shanghai"}
+	// 北京时间 2025-03-10（周一）09:30
+	now := time.Date(2025, 3, 10, 1, 30, 0, 0, time.UTC)
+	monday, due := weeklyReportDue(sub, now)
+	assert.True(t, due)
+	assert.Equal(t, "2025-03-10", monday.Format("2006-01-02"))
+
+	_, due = weeklyReportDue(sub, now.Add(-time.Hour)) // 08:30
+	assert.False(t, due)
+	_, due = weeklyReportDue(sub, now.Add(24*time.Hour)) // 周二
+	assert.False(t, due)
+	sub.LastWeeklyReport = "2025-03-10"
+	_, due = weeklyReportDue(sub, now)
+	assert.False(t, due)
+}
+
+// 测试发送队列结果统计
+func TestOutboxReportAdd(t *testing.T) {
+	var report OutboxReport
+	for _, status := range []string{OutboxSent, OutboxSent, OutboxSkipped, NotifyOutcomeRefused, OutboxPending, OutboxFailed, ""} {
+		report.add(status)
+	}
+	assert.Equal(t, OutboxReport{Sent: 2, Skipped: 1, Refused: 1, Retrying: 1, Failed: 1}, report)
+}
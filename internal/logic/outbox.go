@@ -0,0 +1,257 @@
+package logic
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 发送队列消息状态
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxSent       = "sent"
+	OutboxSkipped    = "skipped"
+	OutboxFailed     = "failed"
+)
+
+// outboxBatchSize 每次从发送队列取出的消息数
+const outboxBatchSize = 100
+
+// enqueueNotification 在业务事务 tx 中写入一条待发送通知，key 相同的消息只写入一次
+// 模板未配置、用户没有该模板的订阅次数或 key 已存在时不写入，返回 false
+func enqueueNotification(tx *gorm.DB, key string, userID uint, kind string, values map[string]string, pageQuery string) (bool, error) {
+	cfg, ok := notifyTemplate(kind)
+	if !ok {
+		return false, nil
+	}
+	var credits int64
+	if err := tx.Model(&db.SubscriptionCredit{}).
+		Where("user_id = ? AND template_id = ? AND credits > 0", userID, cfg.TemplateID).Count(&credits).Error; err != nil {
+		return false, err
+	}
+	if credits == 0 {
+		return false, nil
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return false, err
+	}
+	entry := db.NotificationOutbox{
+		IdempotencyKey: key, UserID: userID, Kind: kind, Values: string(payload), PageQuery: pageQuery,
+		Status: OutboxPending, NextAttemptAt: time.Now(),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	return result.RowsAffected > 0, result.Error
+}
+
+// OutboxReport 一次处理发送队列的结果
+type OutboxReport struct {
+	Sent     int `json:"sent"`
+	Skipped  int `json:"skipped"`  // 发送时订阅次数已用完
+	Refused  int `json:"refused"`  // 用户拒收
+	Retrying int `json:"retrying"` // 稍后重新投递
+	Failed   int `json:"failed"`
+}
+
+func (r *OutboxReport) add(status string) {
+	switch status {
+	case OutboxSent:
+		r.Sent++
+	case OutboxSkipped:
+		r.Skipped++
+	case NotifyOutcomeRefused:
+		r.Refused++
+	case OutboxPending:
+		r.Retrying++
+	case OutboxFailed:
+		r.Failed++
+	}
+}
+
+// claimOutboxEntry 取得消息的租约，并在同一事务中扣减订阅次数（重新投递时已扣过则不再扣）
+// 返回消息状态：processing 可发送，skipped 没有订阅次数，空串表示已被其他实例取走
+func claimOutboxEntry(entry *db.NotificationOutbox, templateID string) (string, error) {
+	status := ""
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		lease := now.Add(common.OutboxLease)
+		claim := tx.Model(&db.NotificationOutbox{}).
+			Where("id = ? AND ((status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?))",
+				entry.ID, OutboxPending, now, OutboxProcessing, now).
+			Updates(map[string]any{"status": OutboxProcessing, "locked_until": lease, "attempts": gorm.Expr("attempts + 1")})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			return claim.Error
+		}
+		if err := tx.First(entry, entry.ID).Error; err != nil {
+			return err
+		}
+		status = OutboxProcessing
+		if entry.CreditConsumed {
+			return nil
+		}
+		ok, err := consumeSubscriptionCredit(tx, entry.UserID, templateID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			status = OutboxSkipped
+			return tx.Model(entry).Updates(map[string]any{"status": OutboxSkipped, "locked_until": nil}).Error
+		}
+		entry.CreditConsumed = true
+		return tx.Model(entry).Update("credit_consumed", true).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// alreadyDelivered 上次投递已发送成功但未来得及更新状态（如实例崩溃）时，避免重复发送
+func alreadyDelivered(outboxID uint) bool {
+	var count int64
+	db.GetDB().Model(&db.Notification{}).Where("outbox_id = ? AND outcome = ?", outboxID, NotifyOutcomeSent).Count(&count)
+	return count > 0
+}
+
+// deliverOutboxEntry 投递一条消息，返回最终状态；用户拒收时返回 refused，稍后重试时返回 pending
+func deliverOutboxEntry(entry db.NotificationOutbox) string {
+	cfg, ok := notifyTemplate(entry.Kind)
+	if !ok {
+		db.GetDB().Model(&entry).Updates(map[string]any{"status": OutboxFailed, "last_error": errTemplateDisabled.Error()})
+		return OutboxFailed
+	}
+	status, err := claimOutboxEntry(&entry, cfg.TemplateID)
+	if err != nil {
+		log.Printf("取出通知 %d 失败: %v", entry.ID, err)
+		return ""
+	}
+	if status != OutboxProcessing {
+		return status
+	}
+
+	var sendErr error
+	if !alreadyDelivered(entry.ID) {
+		var values map[string]string
+		if sendErr = json.Unmarshal([]byte(entry.Values), &values); sendErr == nil {
+			var user db.User
+			if sendErr = db.GetDB().First(&user, entry.UserID).Error; sendErr == nil {
+				sendErr = sendNotification(user, entry.Kind, values, entry.PageQuery, entry.ID)
+			}
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]any{"locked_until": nil}
+	result := OutboxSent
+	if sendErr == nil {
+		updates["status"], updates["sent_at"], updates["last_error"] = OutboxSent, now, ""
+	} else {
+		outcome := classifyNotifyError(sendErr)
+		updates["last_error"] = truncateRunes(sendErr.Error(), 255)
+		updates["credit_consumed"] = false
+		switch {
+		case outcome == NotifyOutcomeRefused:
+			updates["status"], result = OutboxFailed, NotifyOutcomeRefused
+		case notifyRetryable(outcome) && entry.Attempts < common.OutboxMaxAttempts:
+			updates["status"], result = OutboxPending, OutboxPending
+			updates["next_attempt_at"] = now.Add(common.OutboxRetryBackoff << (entry.Attempts - 1))
+		default:
+			updates["status"], result = OutboxFailed, OutboxFailed
+		}
+	}
+	// 按本次取出时的投递次数更新状态，租约过期后已被重新取出时不再更新，也不退回次数，避免重复退回
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(&entry).Where("status = ? AND attempts = ?", OutboxProcessing, entry.Attempts).Updates(updates)
+		if update.Error != nil || update.RowsAffected == 0 || sendErr == nil {
+			return update.Error
+		}
+		return settleSubscriptionCredit(tx, entry.UserID, cfg.TemplateID, sendErr)
+	})
+	if err != nil {
+		log.Printf("更新通知 %d 状态失败: %v", entry.ID, err)
+	}
+	if result == OutboxFailed {
+		log.Printf("发送%s通知 %d 给用户 %d 失败: %v", entry.Kind, entry.ID, entry.UserID, sendErr)
+	}
+	return result
+}
+
+var outboxMu sync.Mutex
+
+// drainNotificationOutbox 取出到期的消息，按 ReminderWorkers 并发、ReminderSendRate 限速发送，直到没有到期消息
+func drainNotificationOutbox() OutboxReport {
+	var report OutboxReport
+	if db.GetDB() == nil {
+		return report
+	}
+	// 同一进程内只有一个任务在处理，多实例间通过租约避免重复投递
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	for {
+		now := time.Now()
+		var entries []db.NotificationOutbox
+		if err := db.GetDB().
+			Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)", OutboxPending, now, OutboxProcessing, now).
+			Order("id").Limit(outboxBatchSize).Find(&entries).Error; err != nil {
+			log.Printf("获取待发送通知失败: %v", err)
+			return report
+		}
+		var mu sync.Mutex
+		handled := 0
+		runWorkerPool(len(entries), common.ReminderWorkers, common.ReminderSendRate, func(i int) {
+			status := deliverOutboxEntry(entries[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if status != "" {
+				handled++
+			}
+			report.add(status)
+		})
+		// 本批都被其他实例取走或出错时结束，避免空转
+		if len(entries) < outboxBatchSize || handled == 0 {
+			return report
+		}
+	}
+}
+
+// DrainNotificationOutbox 处理发送队列并记录结果
+func DrainNotificationOutbox() {
+	report := drainNotificationOutbox()
+	if report != (OutboxReport{}) {
+		log.Printf("发送队列处理完成: 成功 %d，无订阅次数 %d，拒收 %d，待重试 %d，失败 %d",
+			report.Sent, report.Skipped, report.Refused, report.Retrying, report.Failed)
+	}
+}
+
+var outboxKick = make(chan struct{}, 1)
+
+// kickOutbox 有新消息入队时唤醒发送任务
+func kickOutbox() {
+	select {
+	case outboxKick <- struct{}{}:
+	default:
+	}
+}
+
+// startOutboxWorker 每隔 OutboxPollInterval 或被唤醒时处理发送队列
+func startOutboxWorker() {
+	go func() {
+		ticker := time.NewTicker(common.OutboxPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-outboxKick:
+			}
+			DrainNotificationOutbox()
+		}
+	}()
+}
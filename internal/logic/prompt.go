@@ -0,0 +1,196 @@
+package logic
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// CounselorPromptName 戒瘾咨询师系统提示词的模板名
+const CounselorPromptName = "counselor"
+
+// PromptVars 提示词模板可用变量
+type PromptVars struct {
+	Nickname           string
+	CurrentStreak      int
+	DaysSinceLastBreak int // 从未破戒时为注册至今天数
+}
+
+// renderPrompt 渲染提示词模板，引用不存在的变量时报错
+func renderPrompt(content string, vars PromptVars) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// pickPromptVariant 按权重为用户确定性地分配一个版本，同一用户在版本集合不变时始终命中同一版本
+func pickPromptVariant(templates []db.PromptTemplate, userID uint) *db.PromptTemplate {
+	if len(templates) == 0 {
+		return nil
+	}
+	total := 0
+	for _, t := range templates {
+		total += max(t.Weight, 0)
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", templates[0].Name, userID)
+	if total == 0 {
+		// 未设置权重时均分
+		return &templates[h.Sum32()%uint32(len(templates))]
+	}
+	slot := int(h.Sum32() % uint32(total))
+	for i := range templates {
+		slot -= max(templates[i].Weight, 0)
+		if slot < 0 {
+			return &templates[i]
+		}
+	}
+	return &templates[len(templates)-1]
+}
+
+// buildPromptVars 根据用户打卡数据计算模板变量
+func buildPromptVars(user *db.User, stats SignStats) PromptVars {
+	vars := PromptVars{Nickname: user.Nickname, CurrentStreak: stats.CurrentStreak}
+	since := user.CreatedAt
+	if stats.LastBreakDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", stats.LastBreakDate, time.Local); err == nil {
+			since = t
+		}
+	}
+	if !since.IsZero() {
+		vars.DaysSinceLastBreak = int(time.Since(since).Hours() / 24)
+	}
+	return vars
+}
+
+// resolveSystemPrompt 返回用户本次对话使用的系统提示词及其版本，无可用模板时使用内置 RolePrompt（版本0）
+func resolveSystemPrompt(user *db.User, stats SignStats) (string, int) {
+	var templates []db.PromptTemplate
+	db.GetDB().Where("name = ? AND active = ?", CounselorPromptName, true).Order("version asc").Find(&templates)
+	tmpl := pickPromptVariant(templates, user.ID)
+	if tmpl == nil {
+		return common.RolePrompt, 0
+	}
+	prompt, err := renderPrompt(tmpl.Content, buildPromptVars(user, stats))
+	if err != nil {
+		log.Printf("[Prompt] 渲染提示词 %s v%d 失败: %v", tmpl.Name, tmpl.Version, err)
+		return common.RolePrompt, 0
+	}
+	return prompt, tmpl.Version
+}
+
+// ListPromptsHandler 提示词版本列表
+func ListPromptsHandler(c *gin.Context) {
+	name := c.DefaultQuery("name", CounselorPromptName)
+	var templates []db.PromptTemplate
+	if err := db.GetDB().Where("name = ?", name).Order("version desc").Find(&templates).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"prompts": templates})
+}
+
+// CreatePromptHandler 新建提示词版本，内容不可修改，修改即新建版本
+func CreatePromptHandler(c *gin.Context) {
+	var req struct {
+		Name    string `json:"name"`
+		Content string `json:"content"`
+		Note    string `json:"note"`
+		Active  bool   `json:"active"`
+		Weight  int    `json:"weight"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Content == "" {
+		c.JSON(400, gin.H{"error": "content required"})
+		return
+	}
+	if req.Name == "" {
+		req.Name = CounselorPromptName
+	}
+	if req.Weight < 0 {
+		c.JSON(400, gin.H{"error": "weight must be >= 0"})
+		return
+	}
+	if _, err := renderPrompt(req.Content, PromptVars{Nickname: "戒友", CurrentStreak: 1, DaysSinceLastBreak: 1}); err != nil {
+		c.JSON(400, gin.H{"error": "invalid template", "detail": err.Error()})
+		return
+	}
+	tmpl := db.PromptTemplate{
+		Name:    req.Name,
+		Content: req.Content,
+		Note:    req.Note,
+		Active:  req.Active,
+		Weight:  req.Weight,
+	}
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var maxVersion int
+		if err := tx.Model(&db.PromptTemplate{}).Where("name = ?", req.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+		tmpl.Version = maxVersion + 1
+		return tx.Create(&tmpl).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"prompt": tmpl})
+}
+
+// UpdatePromptStatusHandler 启用/停用提示词版本并调整分流权重
+func UpdatePromptStatusHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid prompt ID"})
+		return
+	}
+	var req struct {
+		Active *bool `json:"active"`
+		Weight *int  `json:"weight"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Active == nil && req.Weight == nil) {
+		c.JSON(400, gin.H{"error": "active or weight required"})
+		return
+	}
+	if req.Weight != nil && *req.Weight < 0 {
+		c.JSON(400, gin.H{"error": "weight must be >= 0"})
+		return
+	}
+	var tmpl db.PromptTemplate
+	if err := db.GetDB().First(&tmpl, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(404, gin.H{"error": "prompt not found"})
+		} else {
+			c.JSON(500, gin.H{"error": "db error"})
+		}
+		return
+	}
+	updates := map[string]interface{}{}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if req.Weight != nil {
+		updates["weight"] = *req.Weight
+	}
+	if err := db.GetDB().Model(&tmpl).Updates(updates).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"prompt": tmpl})
+}
@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试提示词模板变量渲染
+func TestRenderPrompt(t *testing.T) {
+	out, err := renderPrompt("你好{{.Nickname}}，已坚持{{.CurrentStreak}}天，距上次破戒{{.DaysSinceLastBreak}}天",
+		PromptVars{Nickname: "戒友1", CurrentStreak: 7, DaysSinceLastBreak: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, "你好戒友1，已坚持7天，距上次破戒9天", out)
+
+	_, err = renderPrompt("{{.Unknown}}", PromptVars{})
+	assert.Error(t, err)
+}
+
+// 测试A/B分流确定性及权重
+func TestPickPromptVariant(t *testing.T) {
+	templates := []db.PromptTemplate{
+		{Name: CounselorPromptName, Version: 1, Weight: 1},
+		{Name: CounselorPromptName, Version: 2, Weight: 3},
+	}
+	assert.Nil(t, pickPromptVariant(nil, 1))
+
+	counts := map[int]int{}
+	for uid := uint(1); uid <= 4000; uid++ {
+		v := pickPromptVariant(templates, uid)
+		assert.Equal(t, v.Version, pickPromptVariant(templates, uid).Version)
+		counts[v.Version]++
+	}
+	assert.InDelta(t, 1000, counts[1], 200)
+	assert.InDelta(t, 3000, counts[2], 200)
+
+	// 权重为0的版本不会被选中
+	templates[0].Weight = 0
+	for uid := uint(1); uid <= 100; uid++ {
+		assert.Equal(t, 2, pickPromptVariant(templates, uid).Version)
+	}
+}
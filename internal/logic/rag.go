@@ -0,0 +1,589 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	langopenai "github.com/tmc/langchaingo/llms/openai"
+	"gorm.io/gorm"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 切片参数（按字符数）
+const (
+	ChunkSize    = 200
+	ChunkOverlap = 40
+)
+
+// Embedder 文本向量化
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// localEmbedder 纯Go的本地哈希向量（字/词n-gram特征哈希），无需网络，适合离线和测试
+type localEmbedder struct {
+	dim int
+}
+
+func (e *localEmbedder) Name() string {
+	return fmt.Sprintf("local-hash-%d", e.dim)
+}
+
+func (e *localEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, e.dim)
+		for _, term := range tokenizeForSearch(text) {
+			h := fnv.New32a()
+			h.Write([]byte(term))
+			sum := h.Sum32()
+			sign := float32(1)
+			if sum&(1<<31) != 0 {
+				sign = -1
+			}
+			vec[sum%uint32(e.dim)] += sign
+		}
+		vectors[i] = normalizeVector(vec)
+	}
+	return vectors, nil
+}
+
+// hunyuanEmbedder 混元OpenAI兼容的Embedding接口
+type hunyuanEmbedder struct{}
+
+func (e *hunyuanEmbedder) Name() string {
+	return common.HunyuanEmbeddingModel
+}
+
+func (e *hunyuanEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	llm, err := langopenai.New(
+		langopenai.WithToken(common.HunyuanToken),
+		langopenai.WithBaseURL(common.HunyuanBaseUrl),
+		langopenai.WithEmbeddingModel(common.HunyuanEmbeddingModel))
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := llm.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range vectors {
+		vectors[i] = normalizeVector(vectors[i])
+	}
+	return vectors, nil
+}
+
+var (
+	articleEmbedder     Embedder
+	articleEmbedderOnce sync.Once
+)
+
+// getEmbedder 按 RAG_EMBEDDER 配置返回向量化实现
+func getEmbedder() Embedder {
+	articleEmbedderOnce.Do(func() {
+		if common.RAGEmbedder == "hunyuan" {
+			articleEmbedder = &hunyuanEmbedder{}
+		} else {
+			articleEmbedder = &localEmbedder{dim: 256}
+		}
+	})
+	return articleEmbedder
+}
+
+func normalizeVector(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] = float32(float64(vec[i]) / norm)
+	}
+	return vec
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// tokenizeForSearch 检索用分词：中文取单字和相邻二字，英文数字按词，统一小写
+func tokenizeForSearch(text string) []string {
+	var terms []string
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		for i := range han {
+			terms = append(terms, string(han[i]))
+			if i+1 < len(han) {
+				terms = append(terms, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return terms
+}
+
+// chunkText 按句切分后拼成不超过 ChunkSize 字的片段，相邻片段重叠 ChunkOverlap 字
+func chunkText(text string) []string {
+	var sentences []string
+	var cur []rune
+	for _, r := range strings.TrimSpace(text) {
+		cur = append(cur, r)
+		if strings.ContainsRune("。！？!?；;\n", r) {
+			if s := strings.TrimSpace(string(cur)); s != "" {
+				sentences = append(sentences, s)
+			}
+			cur = cur[:0]
+		}
+	}
+	if s := strings.TrimSpace(string(cur)); s != "" {
+		sentences = append(sentences, s)
+	}
+
+	var chunks []string
+	var buf []rune
+	fresh := 0 // buf 中不属于上一片段重叠部分的字数
+	flush := func() {
+		chunks = append(chunks, string(buf))
+		if len(buf) > ChunkOverlap {
+			buf = append([]rune(nil), buf[len(buf)-ChunkOverlap:]...)
+		}
+		fresh = 0
+	}
+	for _, s := range sentences {
+		rs := []rune(s)
+		for len(rs) > 0 {
+			space := ChunkSize - len(buf)
+			if len(rs) <= space {
+				buf = append(buf, rs...)
+				fresh += len(rs)
+				break
+			}
+			// 句子放不下时先结束当前片段；句子本身超长则硬切
+			if fresh > 0 && len(rs) <= ChunkSize-ChunkOverlap {
+				flush()
+				continue
+			}
+			buf = append(buf, rs[:space]...)
+			fresh += space
+			rs = rs[space:]
+			flush()
+		}
+	}
+	if fresh > 0 {
+		chunks = append(chunks, string(buf))
+	}
+	return chunks
+}
+
+// RetrievedChunk 检索到的文章片段
+type RetrievedChunk struct {
+	ArticleID uint    `json:"article_id"`
+	Title     string  `json:"title"`
+	Content   string  `json:"content"`
+	Score     float64 `json:"score"`
+}
+
+type indexedChunk struct {
+	ArticleID uint
+	Title     string
+	Content   string
+	Vector    []float32
+	Terms     map[string]int
+	Length    int
+}
+
+// ArticleIndex 内存中的文章检索索引，向量相似度与BM25混合打分
+type ArticleIndex struct {
+	mu       sync.RWMutex
+	chunks   []indexedChunk
+	df       map[string]int
+	totalLen int
+}
+
+func newIndexedChunk(articleID uint, title, content string, vector []float32) indexedChunk {
+	terms := map[string]int{}
+	all := tokenizeForSearch(title + "\n" + content)
+	for _, t := range all {
+		terms[t]++
+	}
+	return indexedChunk{ArticleID: articleID, Title: title, Content: content, Vector: vector, Terms: terms, Length: len(all)}
+}
+
+// replaceArticle 替换某篇文章的全部片段
+func (idx *ArticleIndex) replaceArticle(articleID uint, chunks []indexedChunk) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(articleID)
+	if idx.df == nil {
+		idx.df = map[string]int{}
+	}
+	for _, c := range chunks {
+		for t := range c.Terms {
+			idx.df[t]++
+		}
+		idx.totalLen += c.Length
+		idx.chunks = append(idx.chunks, c)
+	}
+}
+
+func (idx *ArticleIndex) removeArticle(articleID uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(articleID)
+}
+
+func (idx *ArticleIndex) removeLocked(articleID uint) {
+	kept := idx.chunks[:0]
+	for _, c := range idx.chunks {
+		if c.ArticleID != articleID {
+			kept = append(kept, c)
+			continue
+		}
+		for t := range c.Terms {
+			if idx.df[t]--; idx.df[t] <= 0 {
+				delete(idx.df, t)
+			}
+		}
+		idx.totalLen -= c.Length
+	}
+	idx.chunks = kept
+}
+
+// Size 索引中的片段数
+func (idx *ArticleIndex) Size() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.chunks)
+}
+
+// Search 检索最相关的文章片段，每篇文章只保留得分最高的片段
+// BM25 得分经 s/(s+bm25Saturation) 压缩到 [0,1)；有向量时与余弦相似度各占一半
+func (idx *ArticleIndex) Search(queryVec []float32, query string, k int, minScore float64) []RetrievedChunk {
+	const k1, b, bm25Saturation = 1.2, 0.75, 5.0
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if len(idx.chunks) == 0 || k <= 0 {
+		return nil
+	}
+	queryTerms := map[string]bool{}
+	for _, t := range tokenizeForSearch(query) {
+		queryTerms[t] = true
+	}
+	n := float64(len(idx.chunks))
+	avgLen := float64(idx.totalLen) / n
+	best := map[uint]RetrievedChunk{}
+	for _, c := range idx.chunks {
+		var bm25 float64
+		for t := range queryTerms {
+			tf := float64(c.Terms[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.df[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			bm25 += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(c.Length)/avgLen))
+		}
+		score := bm25 / (bm25 + bm25Saturation)
+		if queryVec != nil && len(queryVec) == len(c.Vector) {
+			score = 0.5*score + 0.5*math.Max(cosine(queryVec, c.Vector), 0)
+		}
+		if score < minScore {
+			continue
+		}
+		if prev, ok := best[c.ArticleID]; !ok || score > prev.Score {
+			best[c.ArticleID] = RetrievedChunk{ArticleID: c.ArticleID, Title: c.Title, Content: c.Content, Score: score}
+		}
+	}
+	results := make([]RetrievedChunk, 0, len(best))
+	for _, r := range best {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ArticleID < results[j].ArticleID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// articleIndex 全局文章检索索引
+var articleIndex = &ArticleIndex{}
+
+// articleIndexText 参与检索的文章文本
+func articleIndexText(article *db.Article) string {
+	text := article.Title + "\n" + article.Desc
+	if article.Body != "" {
+		text += "\n" + article.Body
+	}
+	return text
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// IndexArticle 切片并向量化文章，内容未变化时直接复用已存储的向量
+func IndexArticle(ctx context.Context, article *db.Article) error {
+	embedder := getEmbedder()
+	text := articleIndexText(article)
+	hash := contentHash(text)
+
+	var existing []db.ArticleChunk
+	db.GetDB().Where("article_id = ? AND embedding_model = ?", article.ID, embedder.Name()).Order("chunk_index asc").Find(&existing)
+	if len(existing) > 0 && existing[0].ContentHash == hash {
+		var chunks []indexedChunk
+		for _, row := range existing {
+			var vec []float32
+			json.Unmarshal([]byte(row.Embedding), &vec)
+			chunks = append(chunks, newIndexedChunk(article.ID, article.Title, row.Content, vec))
+		}
+		articleIndex.replaceArticle(article.ID, chunks)
+		return nil
+	}
+
+	pieces := chunkText(text)
+	vectors, err := embedder.Embed(ctx, pieces)
+	if err != nil {
+		return err
+	}
+	var rows []db.ArticleChunk
+	var chunks []indexedChunk
+	for i, piece := range pieces {
+		vec, _ := json.Marshal(vectors[i])
+		rows = append(rows, db.ArticleChunk{
+			ArticleID:      article.ID,
+			ChunkIndex:     i,
+			Content:        piece,
+			ContentHash:    hash,
+			EmbeddingModel: embedder.Name(),
+			Embedding:      string(vec),
+		})
+		chunks = append(chunks, newIndexedChunk(article.ID, article.Title, piece, vectors[i]))
+	}
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("article_id = ?", article.ID).Delete(&db.ArticleChunk{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return err
+	}
+	articleIndex.replaceArticle(article.ID, chunks)
+	return nil
+}
+
+// RemoveArticleFromIndex 删除文章的检索数据
+func RemoveArticleFromIndex(articleID uint) {
+	articleIndex.removeArticle(articleID)
+	if err := db.GetDB().Where("article_id = ?", articleID).Delete(&db.ArticleChunk{}).Error; err != nil {
+		log.Printf("[RAG] 删除文章 %d 的切片失败: %v", articleID, err)
+	}
+}
+
+// ReindexAllArticles 重建全部已发布文章的索引，并清理已删除或未发布文章的切片
+func ReindexAllArticles(ctx context.Context) (int, error) {
+	var articles []db.Article
+	if err := db.GetDB().Where("status = ?", db.ArticleStatusPublished).Find(&articles).Error; err != nil {
+		return 0, err
+	}
+	ids := make([]uint, 0, len(articles))
+	indexed := 0
+	for i := range articles {
+		ids = append(ids, articles[i].ID)
+		if err := IndexArticle(ctx, &articles[i]); err != nil {
+			log.Printf("[RAG] 索引文章 %d 失败: %v", articles[i].ID, err)
+			continue
+		}
+		indexed++
+	}
+	stale := db.GetDB().Model(&db.ArticleChunk{})
+	if len(ids) > 0 {
+		stale = stale.Where("article_id NOT IN ?", ids)
+	}
+	stale.Delete(&db.ArticleChunk{})
+	return indexed, nil
+}
+
+// reindexArticleAsync 文章变更后异步更新索引
+// 索引内容会作为参考文章注入所有用户的对话，只能从管理接口、导入和定时发布调用
+func reindexArticleAsync(articleID uint) {
+	if db.GetDB() == nil {
+		return
+	}
+	go func() {
+		var article db.Article
+		if err := db.GetDB().First(&article, articleID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RemoveArticleFromIndex(articleID)
+			}
+			return
+		}
+		if article.Status != db.ArticleStatusPublished {
+			RemoveArticleFromIndex(articleID)
+			return
+		}
+		if err := IndexArticle(context.Background(), &article); err != nil {
+			log.Printf("[RAG] 索引文章 %d 失败: %v", articleID, err)
+		}
+	}()
+}
+
+// StartArticleIndexer 启动时后台加载/重建文章索引
+func StartArticleIndexer() {
+	if db.GetDB() == nil {
+		return
+	}
+	go func() {
+		n, err := ReindexAllArticles(context.Background())
+		if err != nil {
+			log.Printf("[RAG] 加载文章索引失败: %v", err)
+			return
+		}
+		log.Printf("[RAG] 文章索引就绪: %d 篇文章, %d 个片段", n, articleIndex.Size())
+	}()
+}
+
+// ReindexArticlesHandler 手动重建文章检索索引
+func ReindexArticlesHandler(c *gin.Context) {
+	n, err := ReindexAllArticles(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"indexed": n, "chunks": articleIndex.Size()})
+}
+
+// retrieveArticles 检索与用户消息相关的文章片段，向量化失败时退化为纯BM25
+func retrieveArticles(ctx context.Context, query string) []RetrievedChunk {
+	if common.RAGTopK <= 0 || articleIndex.Size() == 0 {
+		return nil
+	}
+	var queryVec []float32
+	if vectors, err := getEmbedder().Embed(ctx, []string{query}); err == nil && len(vectors) == 1 {
+		queryVec = vectors[0]
+	} else if err != nil {
+		log.Printf("[RAG] 查询向量化失败，仅使用关键词检索: %v", err)
+	}
+	return articleIndex.Search(queryVec, query, common.RAGTopK, common.RAGMinScore)
+}
+
+// formatReferences 渲染为给大模型看的参考资料
+func formatReferences(refs []RetrievedChunk) string {
+	var sb strings.Builder
+	sb.WriteString("【参考文章】以下是资讯库中与用户问题相关的内容。若回答用到其中内容，请在相应句子后标注来源，格式为[文章#编号]；无关时忽略即可。\n")
+	for _, r := range refs {
+		fmt.Fprintf(&sb, "[文章#%d]《%s》：%s\n", r.ArticleID, r.Title, r.Content)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Citation 回复中引用的文章，小程序据此跳转文章详情
+type Citation struct {
+	ArticleID uint   `json:"article_id"`
+	Title     string `json:"title"`
+}
+
+var citationPattern = regexp.MustCompile(`\[文章#(\d+)\]`)
+
+// extractCitations 解析回复中的 [文章#ID] 标注，只保留本次检索提供的文章
+func extractCitations(reply string, refs []RetrievedChunk) []Citation {
+	titles := map[uint]string{}
+	for _, r := range refs {
+		titles[r.ArticleID] = r.Title
+	}
+	var citations []Citation
+	seen := map[uint]bool{}
+	for _, m := range citationPattern.FindAllStringSubmatch(reply, -1) {
+		id, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		title, ok := titles[uint(id)]
+		if !ok || seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		citations = append(citations, Citation{ArticleID: uint(id), Title: title})
+	}
+	return citations
+}
+
+// citationIDs 序列化为ChatRecord.Citations
+func citationIDs(citations []Citation) string {
+	ids := make([]string, 0, len(citations))
+	for _, c := range citations {
+		ids = append(ids, strconv.FormatUint(uint64(c.ArticleID), 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+// loadCitations 根据ChatRecord.Citations还原引用及标题
+func loadCitations(ids string) []Citation {
+	if ids == "" {
+		return nil
+	}
+	var articles []db.Article
+	db.GetDB().Select("id", "title").Where("id IN ?", strings.Split(ids, ",")).Find(&articles)
+	citations := make([]Citation, 0, len(articles))
+	for _, a := range articles {
+		citations = append(citations, Citation{ArticleID: a.ID, Title: a.Title})
+	}
+	return citations
+}
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试检索分词
+func TestTokenizeForSearch(t *testing.T) {
+	assert.Equal(t, []string{"戒", "戒断", "断", "nofap", "30"}, tokenizeForSearch("戒断 NoFap 30"))
+}
+
+// 测试文章切片：长度受限且相邻片段有重叠
+func TestChunkText(t *testing.T) {
+	assert.Equal(t, []string{"短文本。"}, chunkText("短文本。"))
+	assert.Empty(t, chunkText("  "))
+
+	text := strings.Repeat("这是一个用于测试切片的句子。", 40)
+	chunks := chunkText(text)
+	assert.Greater(t, len(chunks), 1)
+	for i, c := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(c), ChunkSize)
+		if i > 0 {
+			prev := []rune(chunks[i-1])
+			assert.True(t, strings.HasPrefix(c, string(prev[len(prev)-ChunkOverlap:])))
+		}
+	}
+
+	// 超长无标点文本硬切
+	long := strings.Repeat("字", ChunkSize*2)
+	for _, c := range chunkText(long) {
+		assert.LessOrEqual(t, utf8.RuneCountInString(c), ChunkSize)
+	}
+}
+
+// 测试本地向量+BM25检索能找到相关文章
+func TestArticleIndexSearch(t *testing.T) {
+	embedder := &localEmbedder{dim: 256}
+	docs := map[uint][2]string{
+		1: {"如何应对深夜的冲动", "深夜独处时冲动最强，可以放下手机、离开卧室、做俯卧撑转移注意力。"},
+		2: {"规律作息的重要性", "保持早睡早起，每天运动半小时，有助于稳定情绪。"},
+		3: {"破戒后如何调整心态", "破戒不代表失败，记录诱因，重新开始打卡。"},
+	}
+	idx := &ArticleIndex{}
+	for id, d := range docs {
+		vecs, _ := embedder.Embed(context.Background(), []string{d[1]})
+		idx.replaceArticle(id, []indexedChunk{newIndexedChunk(id, d[0], d[1], vecs[0])})
+	}
+	assert.Equal(t, 3, idx.Size())
+
+	query := "晚上总是有冲动怎么办"
+	qv, _ := embedder.Embed(context.Background(), []string{query})
+	results := idx.Search(qv[0], query, 2, 0.1)
+	assert.NotEmpty(t, results)
+	assert.Equal(t, uint(1), results[0].ArticleID)
+
+	idx.removeArticle(1)
+	assert.Equal(t, 2, idx.Size())
+	for _, r := range idx.Search(qv[0], query, 3, 0) {
+		assert.NotEqual(t, uint(1), r.ArticleID)
+	}
+}
+
+// 测试解析回复中的文章引用
+func TestExtractCitations(t *testing.T) {
+	refs := []RetrievedChunk{{ArticleID: 3, Title: "破戒后如何调整心态"}, {ArticleID: 5, Title: "规律作息"}}
+	citations := extractCitations("先别自责[文章#3]，可以试试早睡[文章#5][文章#3]，另见[文章#9]", refs)
+	assert.Equal(t, []Citation{{ArticleID: 3, Title: "破戒后如何调整心态"}, {ArticleID: 5, Title: "规律作息"}}, citations)
+	assert.Equal(t, "3,5", citationIDs(citations))
+	assert.Empty(t, extractCitations("没有引用", refs))
+}
@@ -0,0 +1,250 @@
+package logic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 推荐候选及返回数量
+const (
+	RecommendCandidateSize = 200 // 参与打分的最新已发布文章数
+	DefaultRecommendLimit  = 10
+	MaxRecommendLimit      = 30
+	finishedReadProgress   = 80 // 阅读进度达到该值视为已读完
+)
+
+// 用户戒断状态
+const (
+	RecoveryStateNew        = "new"         // 没有打卡记录
+	RecoveryStateRelapsed   = "relapsed"    // 刚破戒
+	RecoveryStateMilestone  = "milestone"   // 临近连续守戒里程碑
+	RecoveryStateLongStreak = "long_streak" // 长期坚持
+	RecoveryStateSteady     = "steady"      // 其他
+)
+
+// RecoveryState 用于推荐的用户戒断状态
+type RecoveryState struct {
+	State  string `json:"state"`
+	Detail string `json:"detail"`
+}
+
+// classifyRecoveryState 根据打卡统计判断用户当前状态
+func classifyRecoveryState(stats SignStats, now time.Time, cfg common.RecommendConfig) RecoveryState {
+	if stats.TotalSign == 0 && stats.TotalBreak == 0 {
+		return RecoveryState{State: RecoveryStateNew, Detail: "还没有打卡记录"}
+	}
+	if stats.LastBreakDate != "" {
+		if d, err := time.ParseInLocation("2006-01-02", stats.LastBreakDate, now.Location()); err == nil {
+			days := int(now.Sub(d).Hours() / 24)
+			if days < cfg.RelapseDays {
+				return RecoveryState{State: RecoveryStateRelapsed, Detail: fmt.Sprintf("%d天前破戒", days)}
+			}
+		}
+	}
+	for _, m := range cfg.Milestones {
+		if m > stats.CurrentStreak && m-stats.CurrentStreak <= cfg.MilestoneWindow {
+			return RecoveryState{State: RecoveryStateMilestone, Detail: fmt.Sprintf("距离连续守戒%d天还差%d天", m, m-stats.CurrentStreak)}
+		}
+	}
+	if stats.CurrentStreak >= cfg.LongStreakDays {
+		return RecoveryState{State: RecoveryStateLongStreak, Detail: fmt.Sprintf("已连续守戒%d天", stats.CurrentStreak)}
+	}
+	return RecoveryState{State: RecoveryStateSteady, Detail: fmt.Sprintf("已连续守戒%d天", stats.CurrentStreak)}
+}
+
+// recommendProfile 打分用的用户画像
+type recommendProfile struct {
+	State      RecoveryState
+	TagWeights map[string]float64 // 阅读、收藏过的文章标签及权重
+	Seen       map[uint]string    // 已读完或已收藏的文章及原因
+}
+
+// ScoreReason 推荐得分构成，score 为加权后的得分
+type ScoreReason struct {
+	Factor string  `json:"factor"`
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail"`
+}
+
+// RecommendedArticle 推荐结果
+type RecommendedArticle struct {
+	Article db.Article    `json:"article"`
+	Score   float64       `json:"score"`
+	Reasons []ScoreReason `json:"reasons"`
+}
+
+// articleTerms 文章标签及分类
+func articleTerms(a *db.Article) []string {
+	terms := append([]string{}, a.Tags...)
+	if a.Category != "" {
+		terms = append(terms, a.Category)
+	}
+	return terms
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// scoreArticles 对候选文章打分并按得分降序返回前 limit 篇
+func scoreArticles(articles []db.Article, profile recommendProfile, cfg common.RecommendConfig, now time.Time, limit int) []RecommendedArticle {
+	stateTags := map[string]bool{}
+	for _, t := range cfg.StateTags[profile.State.State] {
+		stateTags[t] = true
+	}
+	maxAffinity := 0.0
+	for _, w := range profile.TagWeights {
+		maxAffinity = math.Max(maxAffinity, w)
+	}
+	heat := func(a *db.Article) float64 {
+		return math.Log1p(float64(a.ReadCount + 2*a.FavoriteCount + a.LikeCount))
+	}
+	maxHeat := 0.0
+	for i := range articles {
+		maxHeat = math.Max(maxHeat, heat(&articles[i]))
+	}
+
+	results := make([]RecommendedArticle, 0, len(articles))
+	for i := range articles {
+		a := &articles[i]
+		var reasons []ScoreReason
+		total := 0.0
+		add := func(factor string, weight, score float64, detail string) {
+			if weight == 0 || score == 0 {
+				return
+			}
+			total += weight * score
+			reasons = append(reasons, ScoreReason{Factor: factor, Score: round3(weight * score), Detail: detail})
+		}
+
+		var matched []string
+		affinity := 0.0
+		var liked []string
+		for _, t := range articleTerms(a) {
+			if stateTags[t] {
+				matched = append(matched, t)
+			}
+			if w := profile.TagWeights[t]; w > 0 {
+				affinity += w
+				liked = append(liked, t)
+			}
+		}
+		add("state", cfg.StateWeight, math.Min(float64(len(matched)), 2)/2,
+			fmt.Sprintf("适合当前状态（%s）：%s", profile.State.Detail, strings.Join(matched, "、")))
+		if maxAffinity > 0 {
+			add("affinity", cfg.AffinityWeight, math.Min(affinity/maxAffinity, 1),
+				"与你读过/收藏的文章相似："+strings.Join(liked, "、"))
+		}
+		if maxHeat > 0 {
+			add("popularity", cfg.PopularityWeight, heat(a)/maxHeat,
+				fmt.Sprintf("%d人阅读，%d人收藏", a.ReadCount, a.FavoriteCount))
+		}
+		published := articlePublishedTime(a)
+		if cfg.FreshnessHalfLifeDays > 0 {
+			ageDays := math.Max(now.Sub(published).Hours()/24, 0)
+			add("freshness", cfg.FreshnessWeight, math.Pow(0.5, ageDays/cfg.FreshnessHalfLifeDays),
+				fmt.Sprintf("发布于%d天前", int(ageDays)))
+		}
+		if why, ok := profile.Seen[a.ID]; ok {
+			reasons = append(reasons, ScoreReason{Factor: "seen", Score: round3(total*cfg.ReadPenalty - total), Detail: why})
+			total *= cfg.ReadPenalty
+		}
+		results = append(results, RecommendedArticle{Article: *a, Score: round3(total), Reasons: reasons})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Article.ID > results[j].Article.ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// loadRecommendProfile 加载用户戒断状态、阅读和收藏偏好
+func loadRecommendProfile(userID uint, now time.Time) recommendProfile {
+	profile := recommendProfile{
+		State:      RecoveryState{State: RecoveryStateNew, Detail: "未登录"},
+		TagWeights: map[string]float64{},
+		Seen:       map[uint]string{},
+	}
+	if userID == 0 {
+		return profile
+	}
+	_, stats := loadSignStats(userID)
+	profile.State = classifyRecoveryState(stats, now, common.Recommend)
+
+	var histories []db.ArticleReadHistory
+	db.GetDB().Where("user_id = ?", userID).Order("last_read_at desc").Limit(100).Find(&histories)
+	var reactions []db.ArticleReaction
+	db.GetDB().Where("user_id = ?", userID).Order("created_at desc").Limit(100).Find(&reactions)
+
+	weights := map[uint]float64{}
+	for _, h := range histories {
+		weights[h.ArticleID] += 1 + float64(h.Progress)/100
+		if h.Progress >= finishedReadProgress {
+			profile.Seen[h.ArticleID] = "已读完"
+		}
+	}
+	for _, r := range reactions {
+		if r.Kind == ReactionFavorite {
+			weights[r.ArticleID] += 2
+			profile.Seen[r.ArticleID] = "已收藏"
+		} else {
+			weights[r.ArticleID]++
+		}
+	}
+	if len(weights) == 0 {
+		return profile
+	}
+	ids := make([]uint, 0, len(weights))
+	for id := range weights {
+		ids = append(ids, id)
+	}
+	var articles []db.Article
+	db.GetDB().Select("id", "category", "tags").Where("id IN ?", ids).Find(&articles)
+	for i := range articles {
+		for _, t := range articleTerms(&articles[i]) {
+			profile.TagWeights[t] += weights[articles[i].ID]
+		}
+	}
+	return profile
+}
+
+// RecommendedArticlesHandler 个性化文章推荐，返回每篇文章的得分构成
+// 参数：openid 可选，未传时只按热度和新鲜度推荐；limit 返回数量
+func RecommendedArticlesHandler(c *gin.Context) {
+	limit := DefaultRecommendLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > MaxRecommendLimit {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = l
+	}
+	now := time.Now()
+	profile := loadRecommendProfile(lookupUserID(c.Query("openid")), now)
+
+	var articles []db.Article
+	if err := db.GetDB().Select(articleListColumns).Where("status = ?", db.ArticleStatusPublished).
+		Order(articlePublishedExpr + " desc, id desc").Limit(RecommendCandidateSize).Find(&articles).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"state":    profile.State,
+		"articles": scoreArticles(articles, profile, common.Recommend, now, limit),
+	})
+}
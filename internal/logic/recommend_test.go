@@ -0,0 +1,51 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 测试根据打卡统计判断戒断状态
+func TestClassifyRecoveryState(t *testing.T) {
+	cfg := common.Recommend
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+
+	assert.Equal(t, RecoveryStateNew, classifyRecoveryState(SignStats{}, now, cfg).State)
+	assert.Equal(t, RecoveryStateRelapsed, classifyRecoveryState(SignStats{TotalBreak: 1, LastBreakDate: "2025-03-09"}, now, cfg).State)
+	assert.Equal(t, RecoveryStateMilestone, classifyRecoveryState(SignStats{TotalSign: 5, CurrentStreak: 5, LastBreakDate: "2025-03-01"}, now, cfg).State)
+	assert.Equal(t, RecoveryStateLongStreak, classifyRecoveryState(SignStats{TotalSign: 40, CurrentStreak: 40}, now, cfg).State)
+	assert.Equal(t, RecoveryStateSteady, classifyRecoveryState(SignStats{TotalSign: 12, CurrentStreak: 12}, now, cfg).State)
+}
+
+// 测试推荐打分：状态匹配、偏好、已读降权及得分解释
+func TestScoreArticles(t *testing.T) {
+	now := time.Now()
+	articles := []db.Article{
+		{ID: 1, Title: "破戒后如何复盘", Tags: []string{"破戒", "复盘"}, CreatedAt: now},
+		{ID: 2, Title: "应对冲动的方法", Tags: []string{"冲动"}, CreatedAt: now, ReadCount: 100},
+		{ID: 3, Title: "重新开始", Tags: []string{"重新开始"}, Category: "破戒", CreatedAt: now},
+	}
+	profile := recommendProfile{
+		State:      RecoveryState{State: RecoveryStateRelapsed, Detail: "1天前破戒"},
+		TagWeights: map[string]float64{"复盘": 2},
+		Seen:       map[uint]string{3: "已读完"},
+	}
+	results := scoreArticles(articles, profile, common.Recommend, now, 10)
+	assert.Len(t, results, 3)
+	assert.Equal(t, uint(1), results[0].Article.ID)
+	assert.Equal(t, uint(3), results[2].Article.ID)
+
+	factors := map[string]bool{}
+	for _, r := range results[2].Reasons {
+		factors[r.Factor] = true
+	}
+	assert.True(t, factors["state"])
+	assert.True(t, factors["seen"])
+
+	assert.Len(t, scoreArticles(articles, profile, common.Recommend, now, 1), 1)
+}
@@ -0,0 +1,138 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"jieyou-backend/internal/db"
+)
+
+// 快照统计窗口
+const (
+	SnapshotRecentBreakDays = 30 // 列出最近N天内的破戒日期
+	SnapshotPatternDays     = 90 // 最近N天内的破戒用于分析星期/时段规律
+	SnapshotMoodCount       = 5  // 最近N条心情
+)
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// RecoverySnapshot 用户戒断情况快照，注入对话上下文
+type RecoverySnapshot struct {
+	CurrentStreak   int
+	BestStreak      int
+	TotalSign       int
+	TotalBreak      int
+	RecentBreaks    []string // 最近破戒日期，倒序
+	PeakWeekdays    []string // 破戒最多的星期
+	PeakTimeOfDay   string   // 破戒最多的时段
+	PatternBreakNum int      // 参与规律分析的破戒次数
+	RecentMoods     []string // 最近心情，倒序
+}
+
+// timeOfDay 将小时映射到时段
+func timeOfDay(hour int) string {
+	switch {
+	case hour < 6:
+		return "凌晨(0-6点)"
+	case hour < 12:
+		return "上午(6-12点)"
+	case hour < 18:
+		return "下午(12-18点)"
+	default:
+		return "晚上(18-24点)"
+	}
+}
+
+// buildRecoverySnapshot 根据按日期升序的打卡记录生成快照
+func buildRecoverySnapshot(records []db.SignRecord, now time.Time) RecoverySnapshot {
+	stats := computeSignStats(records)
+	snap := RecoverySnapshot{
+		CurrentStreak: stats.CurrentStreak,
+		BestStreak:    stats.BestStreak,
+		TotalSign:     stats.TotalSign,
+		TotalBreak:    stats.TotalBreak,
+	}
+	recentFrom := now.AddDate(0, 0, -SnapshotRecentBreakDays).Format("2006-01-02")
+	patternFrom := now.AddDate(0, 0, -SnapshotPatternDays).Format("2006-01-02")
+
+	weekdayCount := make([]int, 7)
+	timeCount := map[string]int{}
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.Mood != "" && len(snap.RecentMoods) < SnapshotMoodCount {
+			snap.RecentMoods = append(snap.RecentMoods, r.Date+" "+r.Mood)
+		}
+		if r.Type != "break" {
+			continue
+		}
+		if r.Date >= recentFrom {
+			snap.RecentBreaks = append(snap.RecentBreaks, r.Date)
+		}
+		if r.Date < patternFrom {
+			continue
+		}
+		d, err := time.ParseInLocation("2006-01-02", r.Date, now.Location())
+		if err != nil {
+			continue
+		}
+		snap.PatternBreakNum++
+		weekdayCount[d.Weekday()]++
+		// 补卡记录的创建时间不代表破戒时间，不参与时段统计
+		if r.CreatedAt.In(now.Location()).Format("2006-01-02") == r.Date {
+			timeCount[timeOfDay(r.CreatedAt.In(now.Location()).Hour())]++
+		}
+	}
+
+	// 至少2次破戒才有规律可言
+	if snap.PatternBreakNum >= 2 {
+		peak := 0
+		for _, n := range weekdayCount {
+			peak = max(peak, n)
+		}
+		if peak >= 2 {
+			for wd, n := range weekdayCount {
+				if n == peak {
+					snap.PeakWeekdays = append(snap.PeakWeekdays, weekdayNames[wd])
+				}
+			}
+		}
+		var buckets []string
+		for k := range timeCount {
+			buckets = append(buckets, k)
+		}
+		sort.Strings(buckets)
+		best := 0
+		for _, k := range buckets {
+			if timeCount[k] >= 2 && timeCount[k] > best {
+				best = timeCount[k]
+				snap.PeakTimeOfDay = k
+			}
+		}
+	}
+	return snap
+}
+
+// String 渲染为给大模型看的文本
+func (s RecoverySnapshot) String() string {
+	var sb strings.Builder
+	sb.WriteString("【用户戒断数据，仅供你参考以给出更贴合的建议，不要向用户逐条复述】\n")
+	fmt.Fprintf(&sb, "- 当前连续守戒：%d天；历史最长连续：%d天\n", s.CurrentStreak, s.BestStreak)
+	fmt.Fprintf(&sb, "- 累计守戒打卡：%d天；累计破戒：%d次\n", s.TotalSign, s.TotalBreak)
+	if len(s.RecentBreaks) == 0 {
+		fmt.Fprintf(&sb, "- 最近%d天没有破戒\n", SnapshotRecentBreakDays)
+	} else {
+		fmt.Fprintf(&sb, "- 最近%d天破戒%d次：%s\n", SnapshotRecentBreakDays, len(s.RecentBreaks), strings.Join(s.RecentBreaks, "、"))
+	}
+	if len(s.PeakWeekdays) > 0 {
+		fmt.Fprintf(&sb, "- 最近%d天破戒多发生在：%s\n", SnapshotPatternDays, strings.Join(s.PeakWeekdays, "、"))
+	}
+	if s.PeakTimeOfDay != "" {
+		fmt.Fprintf(&sb, "- 破戒多发时段：%s\n", s.PeakTimeOfDay)
+	}
+	if len(s.RecentMoods) > 0 {
+		fmt.Fprintf(&sb, "- 最近记录的心情：%s\n", strings.Join(s.RecentMoods, "；"))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试戒断数据快照：连续天数、近期破戒及规律
+func TestBuildRecoverySnapshot(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.Local)
+	at := func(date string, hour int) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		return d.Add(time.Duration(hour) * time.Hour)
+	}
+	records := []db.SignRecord{
+		{Date: "2024-02-01", Type: "sign", CreatedAt: at("2024-02-01", 9)},
+		{Date: "2024-02-02", Type: "sign", CreatedAt: at("2024-02-02", 9)},
+		{Date: "2024-02-03", Type: "sign", CreatedAt: at("2024-02-03", 9)},
+		{Date: "2024-03-01", Type: "break", Mood: "焦虑", CreatedAt: at("2024-03-01", 23)}, // 周五
+		{Date: "2024-03-08", Type: "break", CreatedAt: at("2024-03-08", 22)},             // 周五
+		{Date: "2024-03-18", Type: "sign", CreatedAt: at("2024-03-18", 9)},
+		{Date: "2024-03-19", Type: "sign", Mood: "平静", CreatedAt: at("2024-03-19", 9)},
+	}
+
+	snap := buildRecoverySnapshot(records, now)
+	assert.Equal(t, 2, snap.CurrentStreak)
+	assert.Equal(t, 3, snap.BestStreak)
+	assert.Equal(t, 5, snap.TotalSign)
+	assert.Equal(t, 2, snap.TotalBreak)
+	assert.Equal(t, []string{"2024-03-08", "2024-03-01"}, snap.RecentBreaks)
+	assert.Equal(t, []string{"周五"}, snap.PeakWeekdays)
+	assert.Equal(t, "晚上(18-24点)", snap.PeakTimeOfDay)
+	assert.Equal(t, []string{"2024-03-19 平静", "2024-03-01 焦虑"}, snap.RecentMoods)
+	assert.Contains(t, snap.String(), "当前连续守戒：2天")
+}
+
+// 测试没有破戒记录时的快照
+func TestBuildRecoverySnapshotNoBreak(t *testing.T) {
+	snap := buildRecoverySnapshot(nil, time.Now())
+	assert.Empty(t, snap.RecentBreaks)
+	assert.Empty(t, snap.PeakWeekdays)
+	assert.Contains(t, snap.String(), "没有破戒")
+}
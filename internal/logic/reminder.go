@@ -0,0 +1,266 @@
+package logic
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	_ "time/tzdata" // 容器镜像可能没有时区数据
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+var reminderLocations sync.Map // 时区名 -> *time.Location
+
+// loadReminderLocation 加载时区，结果缓存
+func loadReminderLocation(name string) (*time.Location, error) {
+	if loc, ok := reminderLocations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	reminderLocations.Store(name, loc)
+	return loc, nil
+}
+
+// reminderSetting 用户的提醒时间和时区，未设置或无效时使用默认配置
+func reminderSetting(sub *db.Subscription) (string, *time.Location) {
+	remindTime := sub.RemindTime
+	if _, err := time.Parse("15:04", remindTime); err != nil {
+		remindTime = common.DefaultRemindTime
+	}
+	tz := sub.Timezone
+	if tz == "" {
+		tz = common.DefaultTimezone
+	}
+	loc, err := loadReminderLocation(tz)
+	if err != nil {
+		loc, _ = loadReminderLocation(common.DefaultTimezone)
+	}
+	return remindTime, loc
+}
+
+// localDate 用户时区的日期，打卡记录和打卡提醒都按该日期判断是否为同一天
+func localDate(sub *db.Subscription, now time.Time) string {
+	_, loc := reminderSetting(sub)
+	return now.In(loc).Format("2006-01-02")
+}
+
+// userLocalDate 查询用户的时区设置，返回用户当地日期
+func userLocalDate(userID uint, now time.Time) string {
+	var sub db.Subscription
+	if db.GetDB() != nil {
+		db.GetDB().Where("user_id = ?", userID).Limit(1).Find(&sub)
+	}
+	return localDate(&sub, now)
+}
+
+// dailyReminderDue 判断当前是否应给该用户发送打卡提醒，返回用户当地日期
+// 当地时间到达提醒时间后 ReminderCatchUpWindow 内都算到期，force 时忽略提醒时间；当天已提醒过的不再提醒
+func dailyReminderDue(sub *db.Subscription, now time.Time, force bool) (string, bool) {
+	remindTime, loc := reminderSetting(sub)
+	local := now.In(loc)
+	date := localDate(sub, now)
+	if sub.LastRemindedDate == date {
+		return date, false
+	}
+	if force {
+		return date, true
+	}
+	t, _ := time.Parse("15:04", remindTime)
+	remindAt := time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	return date, !local.Before(remindAt) && local.Sub(remindAt) < common.ReminderCatchUpWindow
+}
+
+// ReminderReport 一次批量发送打卡提醒的结果
+type ReminderReport struct {
+	Due      int          `json:"due"`      // 到达提醒时间且有剩余订阅次数
+	Signed   int          `json:"signed"`   // 当天已打卡或已破戒，不提醒
+	Claimed  int          `json:"claimed"`  // 已被其他实例提醒过
+	Queued   int          `json:"queued"`   // 写入发送队列
+	Delivery OutboxReport `json:"delivery"` // 手动触发时立即处理发送队列的结果
+	Duration string       `json:"duration"`
+}
+
+// reminderCandidate 待提醒的订阅及用户当地日期
+type reminderCandidate struct {
+	sub  *db.Subscription
+	date string
+}
+
+// signedReminderUsers 批量查询候选用户在各自当地日期是否已打卡或破戒，返回 "user_id date" 集合
+func signedReminderUsers(candidates []reminderCandidate) (map[string]bool, error) {
+	signed := map[string]bool{}
+	const batch = 500
+	for lo := 0; lo < len(candidates); lo += batch {
+		hi := min(lo+batch, len(candidates))
+		userIDs := make([]uint, 0, hi-lo)
+		dates := map[string]bool{}
+		for _, c := range candidates[lo:hi] {
+			userIDs = append(userIDs, c.sub.UserID)
+			dates[c.date] = true
+		}
+		dateList := make([]string, 0, len(dates))
+		for d := range dates {
+			dateList = append(dateList, d)
+		}
+		var records []db.SignRecord
+		if err := db.GetDB().Select("user_id, date").
+			Where("user_id IN ? AND date IN ? AND type IN ?", userIDs, dateList, []string{"sign", "break"}).
+			Find(&records).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			signed[fmt.Sprintf("%d %s", r.UserID, r.Date)] = true
+		}
+	}
+	return signed, nil
+}
+
+// dispatchDailyReminders 给到达提醒时间、当天未打卡未破戒且有剩余订阅次数的用户发送打卡提醒
+// 批量查出待提醒用户后写入发送队列，由发送任务按 ReminderWorkers 并发、ReminderSendRate 限速发送；force 时立即处理发送队列
+func dispatchDailyReminders(now time.Time, force bool) ReminderReport {
+	var report ReminderReport
+	if db.GetDB() == nil {
+		log.Println("数据库未初始化，跳过打卡提醒检查")
+		return report
+	}
+	start := time.Now()
+	var subscriptions []db.Subscription
+	if err := db.GetDB().
+		Joins("JOIN subscription_credits c ON c.user_id = subscriptions.user_id AND c.template_id = ? AND c.credits > 0", common.WxTemplateID).
+		Find(&subscriptions).Error; err != nil {
+		log.Printf("获取订阅用户列表失败: %v", err)
+		return report
+	}
+
+	var candidates []reminderCandidate
+	for i := range subscriptions {
+		if date, due := dailyReminderDue(&subscriptions[i], now, force); due {
+			candidates = append(candidates, reminderCandidate{sub: &subscriptions[i], date: date})
+		}
+	}
+	report.Due = len(candidates)
+	signed, err := signedReminderUsers(candidates)
+	if err != nil {
+		log.Printf("查询用户打卡状态失败: %v", err)
+		return report
+	}
+	pending := candidates[:0]
+	for _, c := range candidates {
+		if signed[fmt.Sprintf("%d %s", c.sub.UserID, c.date)] {
+			report.Signed++
+		} else {
+			pending = append(pending, c)
+		}
+	}
+
+	for _, c := range pending {
+		// 占用当天的提醒并写入发送队列，多个实例同时调度时只有一个能写入
+		err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+			claim := tx.Model(&db.Subscription{}).
+				Where("id = ? AND (last_reminded_date IS NULL OR last_reminded_date <> ?)", c.sub.ID, c.date).
+				Update("last_reminded_date", c.date)
+			if claim.Error != nil || claim.RowsAffected == 0 {
+				report.Claimed++
+				return claim.Error
+			}
+			queued, err := enqueueNotification(tx, fmt.Sprintf("%s:%d:%s", NotifyCheckInReminder, c.sub.UserID, c.date),
+				c.sub.UserID, NotifyCheckInReminder, checkInReminderValues(), "")
+			if queued {
+				report.Queued++
+			}
+			return err
+		})
+		if err != nil {
+			log.Printf("写入用户 %d 打卡提醒失败: %v", c.sub.UserID, err)
+		}
+	}
+	if force {
+		report.Delivery = drainNotificationOutbox()
+	} else if report.Queued > 0 {
+		kickOutbox()
+	}
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+	if report.Due > 0 || force {
+		log.Printf("打卡提醒检查完成: 到期 %d 人，已打卡 %d 人，写入发送队列 %d 人，耗时 %s",
+			report.Due, report.Signed, report.Queued, report.Duration)
+	}
+	return report
+}
+
+// DispatchDailyReminders 每分钟调用，给当地时间到达提醒时间的用户发送打卡提醒
+func DispatchDailyReminders() {
+	dispatchDailyReminders(time.Now(), false)
+}
+
+// ReminderSettingsHandler 查询打卡提醒设置，参数 openid
+func ReminderSettingsHandler(c *gin.Context) {
+	openid := c.Query("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	userID := lookupUserID(openid)
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	var sub db.Subscription
+	db.GetDB().Where("user_id = ?", userID).Limit(1).Find(&sub)
+	remindTime, loc := reminderSetting(&sub)
+	c.JSON(200, gin.H{
+		"remind_time":        remindTime,
+		"timezone":           loc.String(),
+		"subscribed":         hasSubscriptionCredit(userID, common.WxTemplateID),
+		"last_reminded_date": sub.LastRemindedDate,
+	})
+}
+
+// UpdateReminderSettingsHandler 设置打卡提醒时间
+// 参数：openid；remind_time 如 "21:00"；timezone 为 IANA 时区名，如 "Asia/Shanghai"，为空时使用默认时区
+func UpdateReminderSettingsHandler(c *gin.Context) {
+	var req struct {
+		OpenID     string `json:"openid"`
+		RemindTime string `json:"remind_time"`
+		Timezone   string `json:"timezone"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	t, err := time.Parse("15:04", req.RemindTime)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "remind_time must be HH:MM"})
+		return
+	}
+	remindTime := t.Format("15:04")
+	if req.Timezone != "" {
+		if _, err := loadReminderLocation(req.Timezone); err != nil {
+			c.JSON(400, gin.H{"error": "invalid timezone"})
+			return
+		}
+	}
+	userID := lookupUserID(req.OpenID)
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	sub := db.Subscription{UserID: userID, RemindTime: remindTime, Timezone: req.Timezone}
+	if err := db.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"remind_time", "timezone", "updated_at"}),
+	}).Create(&sub).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	_, loc := reminderSetting(&sub)
+	c.JSON(200, gin.H{"remind_time": remindTime, "timezone": loc.String()})
+}
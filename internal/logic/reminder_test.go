@@ -0,0 +1,110 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试按用户时区判断打卡提醒是否到期
+func TestDailyReminderDue(t *testing.T) {
+	// 北京时间 2025-03-10 21:10，纽约时间 2025-03-10 09:10
+	now := time.Date(2025, 3, 10, 13, 10, 0, 0, time.UTC)
+
+	date, due := dailyReminderDue(&db.Subscription{RemindTime: "21:00", Timezone: "Asia/Shanghai"}, now, false)
+	assert.True(t, due)
+	assert.Equal(t, "2025-03-10", date)
+
+	// 未到提醒时间
+	_, due = dailyReminderDue(&db.Subscription{RemindTime: "22:00", Timezone: "Asia/Shanghai"}, now, false)
+	assert.False(t, due)
+	// 超过补发时长
+	_, due = dailyReminderDue(&db.Subscription{RemindTime: "08:00", Timezone: "Asia/Shanghai"}, now, false)
+	assert.False(t, due)
+	// 其他时区
+	_, due = dailyReminderDue(&db.Subscription{RemindTime: "09:00", Timezone: "America/New_York"}, now, false)
+	assert.True(t, due)
+	// 当天已提醒过
+	_, due = dailyReminderDue(&db.Subscription{RemindTime: "21:00", Timezone: "Asia/Shanghai", LastRemindedDate: "2025-03-10"}, now, false)
+	assert.False(t, due)
+	// 未设置时使用默认的 20:30 北京时间
+	_, due = dailyReminderDue(&db.Subscription{}, now, false)
+	assert.True(t, due)
+	// 手动触发忽略提醒时间
+	_, due = dailyReminderDue(&db.Subscription{RemindTime: "23:00"}, now, true)
+	assert.True(t, due)
+}
+
+// 测试服务器与用户时区日期不同时，打卡记录与打卡提醒使用同一个用户当地日期
+func TestLocalDateAcrossServerDate(t *testing.T) {
+	// 服务器（UTC）为 2025-03-09 23:00，北京时间已是 2025-03-10 07:00
+	server := time.Date(2025, 3, 9, 23, 0, 0, 0, time.UTC)
+	sub := &db.Subscription{RemindTime: "07:00", Timezone: "Asia/Shanghai"}
+	signDate := localDate(sub, server)
+	assert.Equal(t, "2025-03-10", signDate)
+	assert.NotEqual(t, server.Format("2006-01-02"), signDate)
+
+	// 当晚的提醒查询的是同一天的打卡记录
+	evening := server.Add(13 * time.Hour)
+	sub.RemindTime = "20:00"
+	date, due := dailyReminderDue(sub, evening, false)
+	assert.True(t, due)
+	assert.Equal(t, signDate, date)
+
+	// 未设置时区时使用默认时区
+	assert.Equal(t, "2025-03-10", localDate(&db.Subscription{}, server))
+	// 纽约仍是前一天
+	assert.Equal(t, "2025-03-09", localDate(&db.Subscription{Timezone: "America/New_York"}, server))
+}
+
+// 测试提醒设置参数校验
+func TestUpdateReminderSettingsInvalid(t *testing.T) {
+	router := setupTestRouter()
+	for _, body := range []string{
+		`{"remind_time":"21:00"}`,
+		`{"openid":"u1","remind_time":"25:00"}`,
+		`{"openid":"u1","remind_time":"9pm"}`,
+		`{"openid":"u1","remind_time":"21:00","timezone":"Mars/Base"}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/reminder/settings", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code, body)
+	}
+}
+
+// 测试协程池处理全部任务且不超过并发数和速率
+func TestRunWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int]int{}
+	running, maxRunning := 0, 0
+	start := time.Now()
+	runWorkerPool(10, 3, 50, func(i int) {
+		mu.Lock()
+		seen[i]++
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	assert.Len(t, seen, 10)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 1, seen[i])
+	}
+	assert.LessOrEqual(t, maxRunning, 3)
+	// 每秒50个，10个任务至少间隔 9×20ms
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+
+	runWorkerPool(0, 3, 0, func(int) { t.Fatal("no jobs") })
+}
@@ -8,9 +8,6 @@ import (
 	"time"
 	"unicode/utf8"
 
-	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/memory"
-
 	"jieyou-backend/internal/db"
 
 	"encoding/json"
@@ -25,19 +22,26 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
-	// "github.com/liudding/go-llm-api/tencent" // 移除
-	common_sdk "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
-	v20230901 "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/hunyuan/v20230901"
-	langopenai "github.com/tmc/langchaingo/llms/openai"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const MaxChatPerDay = 10
 const MaxTokenPerMsg = 200
+const MaxMoodLength = 16
+
+// setTrustedProxies 只信任配置的反向代理转发的客户端IP，避免伪造 X-Forwarded-For 绕过限流
+func setTrustedProxies(r *gin.Engine) {
+	if err := r.SetTrustedProxies(common.TrustedProxies); err != nil {
+		log.Printf("TRUSTED_PROXIES 配置无效，不信任任何代理: %v", err)
+		r.SetTrustedProxies(nil)
+	}
+}
 
 // SetupRouter 路由入口
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
+	setTrustedProxies(r)
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "pong"})
@@ -51,23 +55,73 @@ func SetupRouter() *gin.Engine {
 	r.GET("/api/rank/total", TotalRankHandler)
 	r.POST("/api/chat", ChatHandler)
 	r.GET("/api/chat/history", ChatHistoryHandler)
+	r.POST("/api/chat/feedback", ChatFeedbackHandler)
+	r.GET("/api/chat/search", SearchChatHandler)
+	r.GET("/api/memories", ListMemoriesHandler)
+	r.DELETE("/api/memories/:id", DeleteMemoryHandler)
 	r.GET("/api/summary", SummaryHandler)
 	r.GET("/api/articles", GetArticlesHandler)
+	r.GET("/api/articles/search", SearchArticlesHandler)
+	r.GET("/api/articles/recommended", RecommendedArticlesHandler)
+	r.POST("/api/article", ArticleCreateMovedHandler) // 已废弃，创建文章改为 POST /api/admin/articles
 	r.GET("/api/article/:id", GetArticleHandler)
 	r.POST("/api/article/:id/read", IncrementReadCountHandler)
-	r.POST("/api/article", CreateArticleHandler)
+	r.POST("/api/article/:id/favorite", FavoriteArticleHandler)
+	r.DELETE("/api/article/:id/favorite", FavoriteArticleHandler)
+	r.POST("/api/article/:id/like", LikeArticleHandler)
+	r.DELETE("/api/article/:id/like", LikeArticleHandler)
+	r.POST("/api/article/:id/progress", ReadProgressHandler)
+	r.GET("/api/user/bookmarks", BookmarksHandler)
+	r.GET("/api/user/reading_history", ReadingHistoryHandler)
 	r.POST("/api/wxlogin", WxLoginHandler)
 	r.POST("/api/user/update_nickname", UpdateNicknameHandler)
+	r.POST("/api/user/avatar", UploadAvatarHandler)
 	r.GET("/ws/ai", AIWebSocketHandler)
 
+	// 本地存储的媒体文件
+	if common.StorageBackend != "s3" {
+		r.Static(common.LocalStorageURL, common.LocalStorageDir)
+	}
+
 	// 新增：获取模板ID
 	r.GET("/api/template_id", GetTemplateIDHandler)
 
 	// 新增：订阅消息授权接口
 	r.POST("/api/subscription/auth", SubscriptionAuthHandler)
-
-	// 新增：手动触发打卡提醒检查（用于测试）
-	r.POST("/api/check_reminders", CheckRemindersHandler)
+	r.GET("/api/subscription/credits", SubscriptionCreditsHandler)
+
+	// 每日打卡提醒时间设置
+	r.GET("/api/reminder/settings", ReminderSettingsHandler)
+	r.POST("/api/reminder/settings", UpdateReminderSettingsHandler)
+
+	// 管理接口
+	admin := r.Group("/api/admin", AdminAuth())
+	admin.POST("/check_reminders", CheckRemindersHandler) // 手动触发打卡提醒检查（用于测试），忽略用户设置的提醒时间
+	admin.GET("/llm_usage/daily", DailyUsageHandler)
+	admin.GET("/llm_usage/monthly", MonthlyUsageHandler)
+	admin.GET("/llm_usage/top_users", TopUsageUsersHandler)
+	admin.GET("/prompts", ListPromptsHandler)
+	admin.POST("/prompts", CreatePromptHandler)
+	admin.POST("/prompts/:id/status", UpdatePromptStatusHandler)
+	admin.POST("/articles/reindex", ReindexArticlesHandler)
+	admin.POST("/articles/import", ImportArticlesHandler)
+	admin.GET("/articles", AdminListArticlesHandler)
+	admin.POST("/articles", CreateArticleHandler)
+	admin.GET("/articles/:id", AdminGetArticleHandler)
+	admin.PUT("/articles/:id", UpdateArticleHandler)
+	admin.DELETE("/articles/:id", DeleteArticleHandler)
+	admin.POST("/articles/:id/unpublish", UnpublishArticleHandler)
+	admin.POST("/articles/:id/schedule", ScheduleArticleHandler)
+	admin.GET("/articles/:id/revisions", ListArticleRevisionsHandler)
+	admin.GET("/articles/:id/revisions/:rev", GetArticleRevisionHandler)
+	admin.POST("/articles/:id/revisions/:rev/restore", RestoreArticleRevisionHandler)
+	admin.POST("/media", UploadMediaHandler)
+	admin.GET("/notifications", ListNotificationsHandler)
+	admin.GET("/notifications/stats", NotificationStatsHandler)
+	admin.GET("/feedback", ListFeedbackHandler)
+	admin.GET("/feedback/stats", FeedbackStatsHandler)
+	admin.GET("/feedback/export", ExportFeedbackHandler)
+	admin.GET("/feedback/:id/conversation", FeedbackConversationHandler)
 
 	return r
 }
@@ -77,17 +131,23 @@ func SignInHandler(c *gin.Context) {
 	var req struct {
 		OpenID   string `json:"openid"`
 		Nickname string `json:"nickname"`
+		Mood     string `json:"mood"` // 可选：当前心情
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" {
 		c.JSON(400, gin.H{"error": "openid required"})
 		return
 	}
+	if utf8.RuneCountInString(req.Mood) > MaxMoodLength {
+		c.JSON(400, gin.H{"error": "mood too long"})
+		return
+	}
 	user, err := getOrCreateUserByOpenID(req.OpenID, req.Nickname)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "user error"})
 		return
 	}
-	today := time.Now().Format("2006-01-02")
+	// 按用户时区记录日期，与打卡提醒判断当天是否已打卡一致
+	today := userLocalDate(user.ID, time.Now())
 	log.Printf("time: %v", time.Now().Format("2006-01-02 15:04:05"))
 	var count int64
 	db.GetDB().Model(&db.SignRecord{}).Where("user_id = ? AND date = ? AND type = ?", user.ID, today, "sign").Count(&count)
@@ -102,11 +162,23 @@ func SignInHandler(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "今日已破戒"})
 		return
 	}
-	record := db.SignRecord{UserID: user.ID, Date: today, Type: "sign"}
-	if err := db.GetDB().Create(&record).Error; err != nil {
+	// 打卡记录与里程碑通知在同一事务中写入
+	record := db.SignRecord{UserID: user.ID, Date: today, Type: "sign", Mood: req.Mood}
+	queued := false
+	if err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		var err error
+		queued, err = enqueueMilestone(tx, *user, today)
+		return err
+	}); err != nil {
 		c.JSON(500, gin.H{"error": "db error"})
 		return
 	}
+	if queued {
+		kickOutbox()
+	}
 	c.JSON(200, gin.H{"message": "sign in success"})
 }
 
@@ -115,30 +187,48 @@ func BreakHandler(c *gin.Context) {
 	var req struct {
 		OpenID   string `json:"openid"`
 		Nickname string `json:"nickname"`
+		Mood     string `json:"mood"` // 可选：当前心情
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" {
 		c.JSON(400, gin.H{"error": "openid required"})
 		return
 	}
+	if utf8.RuneCountInString(req.Mood) > MaxMoodLength {
+		c.JSON(400, gin.H{"error": "mood too long"})
+		return
+	}
 	user, err := getOrCreateUserByOpenID(req.OpenID, req.Nickname)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "user error"})
 		return
 	}
-	today := time.Now().Format("2006-01-02")
+	today := userLocalDate(user.ID, time.Now())
 	var count int64
 	db.GetDB().Model(&db.SignRecord{}).Where("user_id = ? AND date = ? AND type = ?", user.ID, today, "break").Count(&count)
 	if count > 0 {
 		c.JSON(400, gin.H{"error": "already broke today"})
 		return
 	}
-	// 删除当天的sign记录（如果有）
-	db.GetDB().Where("user_id = ? AND date = ? AND type = ?", user.ID, today, "sign").Delete(&db.SignRecord{})
-	record := db.SignRecord{UserID: user.ID, Date: today, Type: "break"}
-	if err := db.GetDB().Create(&record).Error; err != nil {
+	record := db.SignRecord{UserID: user.ID, Date: today, Type: "break", Mood: req.Mood}
+	queued := false
+	if err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 删除当天的sign记录（如果有）
+		if err := tx.Where("user_id = ? AND date = ? AND type = ?", user.ID, today, "sign").Delete(&db.SignRecord{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		var err error
+		queued, err = enqueueRelapseSupport(tx, *user, today)
+		return err
+	}); err != nil {
 		c.JSON(500, gin.H{"error": "db error"})
 		return
 	}
+	if queued {
+		kickOutbox()
+	}
 	c.JSON(200, gin.H{"message": "break success"})
 }
 
@@ -155,41 +245,8 @@ func CalendarHandler(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "user not found"})
 		return
 	}
-	// 拉取所有记录
-	var records []db.SignRecord
-	db.GetDB().Where("user_id = ?", user.ID).Order("date asc").Find(&records)
-
-	// 统计数据
-	totalSign := 0
-	totalBreak := 0
-	currentStreak := 0
-	lastDate := ""
-	streak := 0
-	// 先统计累计
-	for _, r := range records {
-		if r.Type == "sign" {
-			totalSign++
-		} else if r.Type == "break" {
-			totalBreak++
-		}
-	}
-	// 计算当前连续打卡
-	for _, r := range records {
-		if r.Type == "break" {
-			streak = 0
-			lastDate = r.Date
-			continue
-		}
-		if r.Type == "sign" {
-			if lastDate == "" || nextDay(lastDate) == r.Date {
-				streak++
-			} else {
-				streak = 1
-			}
-			lastDate = r.Date
-		}
-	}
-	currentStreak = streak
+	// 拉取所有记录并统计
+	records, stats := loadSignStats(user.ID)
 
 	// 日历展示，优先展示“破”logo
 	calendar := map[string]string{} // date: "sign"/"break"
@@ -206,9 +263,10 @@ func CalendarHandler(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"records":        records,
 		"calendar":       calendar,
-		"total_sign":     totalSign,
-		"total_break":    totalBreak,
-		"current_streak": currentStreak,
+		"total_sign":     stats.TotalSign,
+		"total_break":    stats.TotalBreak,
+		"current_streak": stats.CurrentStreak,
+		"best_streak":    stats.BestStreak,
 	})
 }
 
@@ -319,6 +377,7 @@ func ChatHandler(c *gin.Context) {
 		OpenID   string `json:"openid"`
 		Nickname string `json:"nickname"`
 		Content  string `json:"content"`
+		MsgID    string `json:"msg_id"` // 可选，不传时由服务端生成
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.OpenID == "" || req.Content == "" {
 		c.JSON(400, gin.H{"error": "openid and content required"})
@@ -344,33 +403,32 @@ func ChatHandler(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "消息包含敏感内容"})
 		return
 	}
-	db.GetDB().Create(&db.ChatRecord{UserID: user.ID, Content: req.Content, IsUser: true})
-	var history []db.ChatRecord
-	db.GetDB().Where("user_id = ?", user.ID).Order("created_at asc").Find(&history)
-
-	ctx := context.Background()
-	// TODO 考虑压缩上下文！
-	chatMemory := memory.NewConversationWindowBuffer(10)
-	chatMemory.ChatHistory.AddUserMessage(ctx, common.RolePrompt)
-	for _, h := range history {
-		if h.IsUser {
-			chatMemory.ChatHistory.AddUserMessage(ctx, h.Content)
-		} else {
-			chatMemory.ChatHistory.AddAIMessage(ctx, h.Content)
-		}
+	if req.MsgID == "" {
+		req.MsgID = newMsgID()
 	}
-	llm, _ := langopenai.New(
-		langopenai.WithToken(common.HunyuanToken),
-		langopenai.WithModel(common.HunyuanModel),
-		langopenai.WithBaseURL(common.HunyuanBaseUrl))
-	chain := chains.NewConversation(llm, chatMemory)
-	resp, err := chains.Run(ctx, chain, req.Content, chains.WithMaxTokens(200))
+	ctx := withUsageMeta(c.Request.Context(), user.ID, req.MsgID, "chat")
+	chatCtx := buildChatContext(ctx, user, req.Content)
+	db.GetDB().Create(&db.ChatRecord{UserID: user.ID, Content: req.Content, IsUser: true, MsgID: req.MsgID})
+
+	res, err := runToolLoop(ctx, getAIProvider(), LLMRequest{Messages: chatCtx.Messages, MaxTokens: MaxTokenPerMsg}, chatTools, &ToolContext{User: user}, nil)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "AI error"})
+		aiErr := toAIError(err)
+		log.Printf("[Chat] user %d AI error: %v", user.ID, err)
+		c.JSON(aiErr.HTTPStatus(), gin.H{"error": "AI error", "code": aiErr.Code, "message": aiErr.Message})
 		return
 	}
-	db.GetDB().Create(&db.ChatRecord{UserID: user.ID, Content: resp, IsUser: false})
-	c.JSON(200, gin.H{"reply": resp})
+	citations := extractCitations(res.Content, chatCtx.References)
+	db.GetDB().Create(&db.ChatRecord{
+		UserID:        user.ID,
+		Content:       res.Content,
+		IsUser:        false,
+		MsgID:         req.MsgID,
+		PromptVersion: chatCtx.PromptVersion,
+		Citations:     citationIDs(citations),
+		Model:         res.Model,
+	})
+	extractUserMemoriesAsync(user.ID, req.MsgID, req.Content, res.Content)
+	c.JSON(200, gin.H{"reply": res.Content, "citations": citations, "msg_id": req.MsgID})
 }
 
 // ChatHistoryHandler 聊天历史接口
@@ -406,14 +464,24 @@ func SummaryHandler(c *gin.Context) {
 	})
 }
 
-// GetArticlesHandler 拉取文章列表
+// GetArticlesHandler 分页拉取已发布的文章列表，不含正文
+// 参数：category、tag 过滤；sort 为 newest/most_read/trending；limit 每页条数；cursor 为上一页返回的 next_cursor
 func GetArticlesHandler(c *gin.Context) {
-	var articles []db.Article
-	db.GetDB().Order("created_at desc").Find(&articles)
-	c.JSON(200, gin.H{"articles": articles})
+	q, err := parseArticleListQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	articles, next, err := listArticles(q)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"articles": articles, "next_cursor": next})
 }
 
-// GetArticleHandler 获取单个文章详情
+// GetArticleHandler 获取单个已发布文章详情，含 Markdown 正文及渲染后的HTML
+// 传入 openid 时附带当前用户的收藏、点赞状态和阅读进度
 func GetArticleHandler(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -421,7 +489,7 @@ func GetArticleHandler(c *gin.Context) {
 		return
 	}
 	var article db.Article
-	if err := db.GetDB().First(&article, id).Error; err != nil {
+	if err := db.GetDB().Where("status = ?", db.ArticleStatusPublished).First(&article, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(404, gin.H{"error": "article not found"})
 		} else {
@@ -430,35 +498,60 @@ func GetArticleHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{"article": article})
+	resp := gin.H{"article": article}
+	if userID := lookupUserID(c.Query("openid")); userID != 0 {
+		resp["user_state"] = articleUserState(userID, article.ID)
+	}
+	c.JSON(200, resp)
+}
+
+// ArticleCreateMovedHandler 原公开的创建文章接口已迁移到管理接口，返回 410 提示新地址
+func ArticleCreateMovedHandler(c *gin.Context) {
+	c.JSON(410, gin.H{"error": "POST /api/article has moved to POST /api/admin/articles (requires X-Admin-Token)", "location": "/api/admin/articles"})
 }
 
-// CreateArticleHandler 创建文章
+// CreateArticleHandler 管理员创建文章，status 默认为 published；发布的文章进入检索索引并通知订阅用户
 func CreateArticleHandler(c *gin.Context) {
-	var req struct {
-		Title string `json:"title"`
-		Desc  string `json:"desc"`
-		Img   string `json:"img"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil || req.Title == "" {
+	var req articleFields
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "title required"})
 		return
 	}
+	if req.Status == "" {
+		req.Status = db.ArticleStatusPublished
+	}
 	article := db.Article{
-		Title:     req.Title,
-		Desc:      req.Desc,
-		Img:       req.Img,
 		CreatedAt: time.Now(),
 		ReadCount: 0,
 	}
-	if err := db.GetDB().Create(&article).Error; err != nil {
+	if err := req.applyTo(&article); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if article.Status == db.ArticleStatusPublished {
+		now := time.Now()
+		article.PublishedAt = &now
+	}
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&article).Error; err != nil {
+			return err
+		}
+		_, err := saveArticleRevision(tx, &article, "创建")
+		return err
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"error": "db error"})
 		return
 	}
+	reindexArticleAsync(article.ID)
+	if article.Status == db.ArticleStatusPublished {
+		notifyNewArticleAsync(article)
+	}
 	c.JSON(200, gin.H{"id": article.ID})
 }
 
-// IncrementReadCountHandler 增加文章阅读量
+// IncrementReadCountHandler 上报文章阅读
+// 同一读者每篇文章每天只计一次，爬虫不计；可选参数 openid（query 或 JSON）用于识别登录用户
 func IncrementReadCountHandler(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -466,11 +559,20 @@ func IncrementReadCountHandler(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid article ID"})
 		return
 	}
-
-	log.Printf("[ReadCount] Incrementing read count for article ID: %d", id)
+	if !readRateLimiter.Allow(c.ClientIP(), common.ReadRateLimitPerMinute, time.Now()) {
+		c.JSON(429, gin.H{"error": "too many requests"})
+		return
+	}
+	var req struct {
+		OpenID string `json:"openid"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.OpenID == "" {
+		req.OpenID = c.Query("openid")
+	}
 
 	var article db.Article
-	if err := db.GetDB().First(&article, id).Error; err != nil {
+	if err := db.GetDB().Select(articleListColumns).Where("status = ?", db.ArticleStatusPublished).First(&article, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			log.Printf("[ReadCount] Article not found: %d", id)
 			c.JSON(404, gin.H{"error": "article not found"})
@@ -481,20 +583,28 @@ func IncrementReadCountHandler(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[ReadCount] Current read count: %d", article.ReadCount)
-
-	// 增加阅读量
-	newReadCount := article.ReadCount + 1
-	if err := db.GetDB().Model(&article).Update("ReadCount", newReadCount).Error; err != nil {
-		log.Printf("[ReadCount] Failed to update read count: %v", err)
-		c.JSON(500, gin.H{"error": "failed to update read count"})
-		return
+	counted := false
+	userID := lookupUserID(req.OpenID)
+	if ua := c.GetHeader("User-Agent"); isBotUserAgent(ua) {
+		log.Printf("[ReadCount] Ignore bot read for article %d, UA: %q", id, ua)
+	} else {
+		if userID != 0 {
+			touchReadHistory(userID, article.ID, -1)
+		}
+		counted, err = recordArticleRead(article.ID, articleReader(c, userID), time.Now())
+		if err != nil {
+			log.Printf("[ReadCount] Failed to record read: %v", err)
+			c.JSON(500, gin.H{"error": "failed to update read count"})
+			return
+		}
 	}
 
-	article.ReadCount = newReadCount // 更新本地对象，确保返回正确的阅读量
-	log.Printf("[ReadCount] Updated read count to: %d", article.ReadCount)
-
-	c.JSON(200, gin.H{"article": article})
+	// 返回包含本次及尚未写库的阅读量
+	if counted && common.ReadCountFlushInterval == 0 {
+		article.ReadCount++
+	}
+	article.ReadCount += articleReadBuffer.pending(article.ID)
+	c.JSON(200, gin.H{"article": article, "counted": counted})
 }
 
 // WxLoginHandler 微信登录接口
@@ -510,7 +620,7 @@ func WxLoginHandler(c *gin.Context) {
 	}
 	appid := common.WxAPPID
 	secret := common.WxAPPSecret
-	url := fmt.Sprintf("https://api.weixin.qq.com/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code", appid, secret, req.Code)
+	url := fmt.Sprintf("%s/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code", common.WxAPIBaseURL, appid, secret, req.Code)
 	resp, err := http.Get(url)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "wx api error", "detail": err.Error()})
@@ -595,8 +705,25 @@ var upgrader = websocket.Upgrader{
 
 // AI流式回复会话（仅适合单实例开发环境）
 type StreamSession struct {
-	History []rune        // 已发送内容
-	Done    chan struct{} // 结束信号
+	History   []rune        // 已发送内容
+	Done      chan struct{} // 结束信号
+	Err       *AIError      // AI调用失败原因，Done关闭后可读
+	Citations []Citation    // 回复引用的文章，Done关闭后可读
+}
+
+// AIStreamErrorPrefix 流式回复出错时发给前端的消息前缀，后跟 {"code","message"} JSON，随后仍会发送 [[END]]
+const AIStreamErrorPrefix = "[[ERROR]]"
+
+// AIStreamCitationsPrefix 回复引用文章时在 [[END]] 前发送，后跟 [{"article_id","title"}] JSON
+const AIStreamCitationsPrefix = "[[CITATIONS]]"
+
+// writeCitations 向前端发送引用文章
+func writeCitations(conn *websocket.Conn, citations []Citation) {
+	if len(citations) == 0 {
+		return
+	}
+	b, _ := json.Marshal(citations)
+	conn.WriteMessage(websocket.TextMessage, append([]byte(AIStreamCitationsPrefix), b...))
 }
 
 var aiStreamSessions = make(map[string]*StreamSession) // key: userID+msgID
@@ -643,6 +770,7 @@ func AIWebSocketHandler(c *gin.Context) {
 			toSend := aiRunes[req.ReceivedLen:]
 			conn.WriteMessage(websocket.TextMessage, []byte(string(toSend)))
 		}
+		writeCitations(conn, loadCitations(aiRecord.Citations))
 		conn.WriteMessage(websocket.TextMessage, []byte("[[END]]"))
 		return
 	}
@@ -658,29 +786,7 @@ func AIWebSocketHandler(c *gin.Context) {
 		aiStreamSessions[cacheKey] = session
 		aiStreamSessionsLock.Unlock()
 
-		// 查找最近N条历史消息
-		var records []db.ChatRecord
-		db.GetDB().Where("user_id = ?", user.ID).Order("created_at desc").Limit(10).Find(&records)
-		var history []*v20230901.Message
-		history = append(history, &v20230901.Message{
-			Role:    common_sdk.StringPtr("system"),
-			Content: common_sdk.StringPtr(common.RolePrompt),
-		})
-		for i := len(records) - 1; i >= 0; i-- {
-			r := records[i]
-			role := "assistant"
-			if r.IsUser {
-				role = "user"
-			}
-			history = append(history, &v20230901.Message{
-				Role:    common_sdk.StringPtr(role),
-				Content: common_sdk.StringPtr(r.Content),
-			})
-		}
-		history = append(history, &v20230901.Message{
-			Role:    common_sdk.StringPtr("user"),
-			Content: common_sdk.StringPtr(req.Content),
-		})
+		chatCtx := buildChatContext(context.Background(), &user, req.Content)
 		db.GetDB().Create(&db.ChatRecord{
 			UserID:    user.ID,
 			Content:   req.Content,
@@ -691,18 +797,36 @@ func AIWebSocketHandler(c *gin.Context) {
 
 		go func(sess *StreamSession) {
 			var aiMsg string
-			_ = HunyuanStreamSDK(history, "hunyuan-turbo", func(delta string) {
+			ctx := withUsageMeta(context.Background(), user.ID, req.MsgID, "ws")
+			res, err := runToolLoop(ctx, getAIProvider(), LLMRequest{Messages: chatCtx.Messages}, chatTools, &ToolContext{User: &user}, func(delta string) {
+				aiStreamSessionsLock.Lock()
 				sess.History = append(sess.History, []rune(delta)...)
+				aiStreamSessionsLock.Unlock()
 				aiMsg += delta
 			})
+			if err != nil {
+				log.Printf("[AIWS] %s AI error: %v", cacheKey, err)
+				sess.Err = toAIError(err)
+			}
+			sess.Citations = extractCitations(aiMsg, chatCtx.References)
+			model := ""
+			if res != nil {
+				model = res.Model
+			}
 			if aiMsg != "" {
 				db.GetDB().Create(&db.ChatRecord{
-					UserID:    user.ID,
-					Content:   aiMsg,
-					IsUser:    false,
-					CreatedAt: time.Now(),
-					MsgID:     req.MsgID,
+					UserID:        user.ID,
+					Content:       aiMsg,
+					IsUser:        false,
+					CreatedAt:     time.Now(),
+					MsgID:         req.MsgID,
+					PromptVersion: chatCtx.PromptVersion,
+					Citations:     citationIDs(sess.Citations),
+					Model:         model,
 				})
+				if sess.Err == nil {
+					extractUserMemoriesAsync(user.ID, req.MsgID, req.Content, aiMsg)
+				}
 			}
 			close(sess.Done)
 			aiStreamSessionsLock.Lock()
@@ -720,7 +844,9 @@ func AIWebSocketHandler(c *gin.Context) {
 		curLen := len(session.History)
 		aiStreamSessionsLock.Unlock()
 		if sentLen < curLen {
-			toSend := session.History[sentLen:]
+			aiStreamSessionsLock.Lock()
+			toSend := session.History[sentLen:curLen]
+			aiStreamSessionsLock.Unlock()
 			err := conn.WriteMessage(websocket.TextMessage, []byte(string(toSend)))
 			if err != nil {
 				log.Printf("[AIWS] conn %s: WriteMessage error: %v", cacheKey, err)
@@ -730,6 +856,18 @@ func AIWebSocketHandler(c *gin.Context) {
 		}
 		select {
 		case <-session.Done:
+			// 补发结束前最后一批内容
+			aiStreamSessionsLock.Lock()
+			rest := session.History[min(sentLen, len(session.History)):]
+			aiStreamSessionsLock.Unlock()
+			if len(rest) > 0 {
+				conn.WriteMessage(websocket.TextMessage, []byte(string(rest)))
+			}
+			if session.Err != nil {
+				errMsg, _ := json.Marshal(gin.H{"code": session.Err.Code, "message": session.Err.Message})
+				conn.WriteMessage(websocket.TextMessage, append([]byte(AIStreamErrorPrefix), errMsg...))
+			}
+			writeCitations(conn, session.Citations)
 			log.Println("[AIWS] Session done, send [[END]]")
 			conn.WriteMessage(websocket.TextMessage, []byte("[[END]]"))
 			return
@@ -739,16 +877,19 @@ func AIWebSocketHandler(c *gin.Context) {
 	}
 }
 
-// GetTemplateIDHandler 获取模板ID
+// GetTemplateIDHandler 获取模板ID，template_id 为打卡提醒模板，templates 为全部可订阅的模板
 func GetTemplateIDHandler(c *gin.Context) {
-	c.JSON(200, gin.H{"template_id": common.WxTemplateID})
+	c.JSON(200, gin.H{"template_id": common.WxTemplateID, "templates": enabledNotifyTemplates()})
 }
 
 // SubscriptionAuthHandler 订阅消息授权接口
+// results 为 wx.requestSubscribeMessage 返回的 {模板ID: accept/reject/ban/filter}，每次 accept 增加一次发送次数；
+// 兼容旧版只传 templateId 的请求，视为该模板 accept
 func SubscriptionAuthHandler(c *gin.Context) {
 	type Req struct {
-		TemplateId string `json:"templateId"`
-		OpenID     string `json:"openid"`
+		TemplateId string            `json:"templateId"`
+		OpenID     string            `json:"openid"`
+		Results    map[string]string `json:"results"`
 	}
 	var req Req
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -763,6 +904,26 @@ func SubscriptionAuthHandler(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "openid required"})
 		return
 	}
+	results := map[string]string{}
+	for templateID, status := range req.Results {
+		// 忽略 errMsg 等非模板字段
+		if isSubscriptionTemplate(templateID) && subscribeStatuses[status] {
+			results[templateID] = status
+		}
+	}
+	if len(req.Results) == 0 {
+		templateID := req.TemplateId
+		if templateID == "" {
+			templateID = common.WxTemplateID
+		}
+		if isSubscriptionTemplate(templateID) {
+			results[templateID] = SubscribeAccept
+		}
+	}
+	if len(results) == 0 {
+		c.JSON(400, gin.H{"error": "no valid template result"})
+		return
+	}
 
 	// 查找用户
 	var user db.User
@@ -776,29 +937,20 @@ func SubscriptionAuthHandler(c *gin.Context) {
 		return
 	}
 
-	// 检查用户是否已授权订阅消息
-	var subscription db.Subscription
-	err = db.GetDB().Where("user_id = ?", user.ID).First(&subscription).Error
-	if err == gorm.ErrRecordNotFound {
-		// 用户未授权，创建记录
-		subscription = db.Subscription{
-			UserID: user.ID,
-			IsAuth: true,
-		}
-		db.GetDB().Create(&subscription)
-		log.Printf("为用户 %s 创建订阅记录", user.Nickname)
-	} else if err != nil {
+	// 提醒设置保存在订阅记录中，首次授权时创建
+	if err := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&db.Subscription{UserID: user.ID}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error", "detail": err.Error()})
+		return
+	}
+	if err := grantSubscriptionCredits(user.ID, results); err != nil {
 		c.JSON(500, gin.H{"error": "db error", "detail": err.Error()})
 		return
-	} else {
-		// 用户已授权，更新记录
-		subscription.IsAuth = true
-		db.GetDB().Save(&subscription)
-		log.Printf("更新用户 %s 的订阅记录", user.Nickname)
 	}
+	log.Printf("记录用户 %s 的订阅授权: %v", user.Nickname, results)
 
 	c.JSON(200, gin.H{
 		"message": "Subscription authorized",
+		"credits": loadSubscriptionCredits(user.ID),
 	})
 }
 
@@ -879,6 +1031,6 @@ func RetroactiveSignInHandler(c *gin.Context) {
 // CheckRemindersHandler 手动触发打卡提醒检查
 func CheckRemindersHandler(c *gin.Context) {
 	log.Println("手动触发打卡提醒检查")
-	CheckAndSendReminders()
-	c.JSON(200, gin.H{"message": "打卡提醒检查已执行"})
+	report := CheckAndSendReminders()
+	c.JSON(200, gin.H{"message": "打卡提醒检查已执行", "report": report})
 }
@@ -9,6 +9,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
 )
 
 // 设置测试环境
@@ -41,10 +43,14 @@ func TestGetTemplateIDHandler(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 
-	var response map[string]string
+	var response struct {
+		TemplateID string               `json:"template_id"`
+		Templates  []NotifyTemplateInfo `json:"templates"`
+	}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, response["template_id"])
+	assert.NotEmpty(t, response.TemplateID)
+	assert.Contains(t, response.Templates, NotifyTemplateInfo{Kind: NotifyCheckInReminder, TemplateID: response.TemplateID})
 }
 
 // 测试签到接口 - 缺少必要参数
@@ -110,14 +116,48 @@ func TestSubscriptionAuthHandlerMissingParams(t *testing.T) {
 // 测试手动触发提醒检查接口
 func TestCheckRemindersHandler(t *testing.T) {
 	router := setupTestRouter()
+	common.AdminToken = "secret"
+	defer func() { common.AdminToken = "" }()
+
+	// 只能通过管理接口触发
+	for _, path := range []string{"/api/check_reminders", "/api/admin/check_reminders"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		router.ServeHTTP(w, req)
+		assert.NotEqual(t, 200, w.Code, path)
+	}
+
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/check_reminders", nil)
+	req, _ := http.NewRequest("POST", "/api/admin/check_reminders", nil)
+	req.Header.Set("X-Admin-Token", "secret")
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
 
-	var response map[string]string
+	var response struct {
+		Message string         `json:"message"`
+		Report  ReminderReport `json:"report"`
+	}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Equal(t, "打卡提醒检查已执行", response["message"])
+	assert.Equal(t, "打卡提醒检查已执行", response.Message)
+	assert.Equal(t, 0, response.Report.Queued)
+}
+
+// 测试回复评价接口 - 参数校验
+func TestChatFeedbackHandlerInvalidParams(t *testing.T) {
+	router := setupTestRouter()
+	cases := []map[string]string{
+		{},
+		{"openid": "test_openid", "msg_id": "m1", "rating": "great"},
+		{"openid": "test_openid", "msg_id": "m1", "rating": "down", "reason": "unknown"},
+	}
+	for _, body := range cases {
+		w := httptest.NewRecorder()
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/api/chat/feedback", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code)
+	}
 }
@@ -0,0 +1,218 @@
+package logic
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"jieyou-backend/internal/db"
+)
+
+// 搜索参数限制
+const (
+	MinSearchQueryLength = 2 // MySQL ngram 分词默认按二字切分，单字无法命中
+	MaxSearchQueryLength = 64
+	DefaultSearchLimit   = 20
+	MaxSearchLimit       = 50
+	SearchSnippetRadius  = 40 // 摘要在命中位置前后各保留的字数
+)
+
+const articleMatchExpr = "MATCH(articles.title, articles.`desc`, articles.body) AGAINST(? IN NATURAL LANGUAGE MODE)"
+const chatMatchExpr = "MATCH(content) AGAINST(? IN NATURAL LANGUAGE MODE)"
+
+// useFullTextSearch 仅 MySQL 使用全文索引，其他数据库退化为内存索引/LIKE
+func useFullTextSearch() bool {
+	return db.GetDB().Dialector.Name() == "mysql"
+}
+
+// parseSearchParams 解析 q 和 limit 参数
+func parseSearchParams(c *gin.Context) (string, int, bool) {
+	q := strings.TrimSpace(c.Query("q"))
+	n := utf8.RuneCountInString(q)
+	if n < MinSearchQueryLength || n > MaxSearchQueryLength {
+		return "", 0, false
+	}
+	limit := DefaultSearchLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > MaxSearchLimit {
+			return "", 0, false
+		}
+		limit = l
+	}
+	return q, limit, true
+}
+
+// makeSnippet 截取命中位置附近的文字作为摘要；优先匹配完整关键词，其次匹配分词
+func makeSnippet(text, query string, radius int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	lower := strings.ToLower(text)
+	pos := strings.Index(lower, strings.ToLower(query))
+	if pos < 0 {
+		for _, term := range tokenizeForSearch(query) {
+			if utf8.RuneCountInString(term) < 2 {
+				continue
+			}
+			if p := strings.Index(lower, term); p >= 0 && (pos < 0 || p < pos) {
+				pos = p
+			}
+		}
+	}
+	runes := []rune(text)
+	start := 0
+	if pos > 0 {
+		start = utf8.RuneCountInString(lower[:pos]) - radius
+	}
+	start = max(start, 0)
+	end := min(start+2*radius, len(runes))
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// ArticleSearchHit 文章搜索结果
+type ArticleSearchHit struct {
+	db.Article
+	Score   float64 `gorm:"column:score;->" json:"score"`
+	Snippet string  `gorm:"-" json:"snippet"`
+}
+
+// searchArticles 搜索已发布文章的标题、简介和正文
+func searchArticles(q string, limit int) ([]ArticleSearchHit, error) {
+	if useFullTextSearch() {
+		var hits []ArticleSearchHit
+		err := db.GetDB().Model(&db.Article{}).
+			Select(articleListSelect()+", articles.body, "+articleMatchExpr+" AS score", q).
+			Where("articles.status = ?", db.ArticleStatusPublished).
+			Where(articleMatchExpr, q).
+			Order("score desc, articles.id desc").Limit(limit).Find(&hits).Error
+		if err == nil {
+			for i := range hits {
+				hits[i].Snippet = makeSnippet(hits[i].Desc+" "+hits[i].Body, q, SearchSnippetRadius)
+				hits[i].Body = ""
+			}
+			return hits, nil
+		}
+		log.Printf("[Search] 文章全文检索失败，改用内存索引: %v", err)
+	}
+	return searchArticlesInMemory(q, limit)
+}
+
+// searchArticlesInMemory 不支持全文索引时，读取已发布文章在内存中检索
+func searchArticlesInMemory(q string, limit int) ([]ArticleSearchHit, error) {
+	var articles []db.Article
+	if err := db.GetDB().Select(append(articleListColumns, "body")).
+		Where("status = ?", db.ArticleStatusPublished).Find(&articles).Error; err != nil {
+		return nil, err
+	}
+	return rankArticles(articles, q, limit), nil
+}
+
+// rankArticles 对给定文章切片后按 BM25 打分（不计算向量），返回得分最高的 limit 篇
+func rankArticles(articles []db.Article, q string, limit int) []ArticleSearchHit {
+	idx := &ArticleIndex{}
+	byID := make(map[uint]*db.Article, len(articles))
+	for i := range articles {
+		a := &articles[i]
+		byID[a.ID] = a
+		var chunks []indexedChunk
+		for _, piece := range chunkText(articleIndexText(a)) {
+			chunks = append(chunks, newIndexedChunk(a.ID, a.Title, piece, nil))
+		}
+		idx.replaceArticle(a.ID, chunks)
+	}
+	chunks := idx.Search(nil, q, limit, math.SmallestNonzeroFloat64)
+	hits := make([]ArticleSearchHit, 0, len(chunks))
+	for _, chunk := range chunks {
+		article := *byID[chunk.ArticleID]
+		article.Body = ""
+		hits = append(hits, ArticleSearchHit{Article: article, Score: chunk.Score, Snippet: makeSnippet(chunk.Content, q, SearchSnippetRadius)})
+	}
+	return hits
+}
+
+// ChatSearchHit 聊天记录搜索结果
+type ChatSearchHit struct {
+	db.ChatRecord
+	Score   float64 `gorm:"column:score;->" json:"score"`
+	Snippet string  `gorm:"-" json:"snippet"`
+}
+
+// searchChatRecords 搜索用户自己的聊天记录
+func searchChatRecords(userID uint, q string, limit int) ([]ChatSearchHit, error) {
+	var hits []ChatSearchHit
+	if useFullTextSearch() {
+		err := db.GetDB().Model(&db.ChatRecord{}).
+			Select("chat_records.*, "+chatMatchExpr+" AS score", q).
+			Where("user_id = ?", userID).
+			Where(chatMatchExpr, q).
+			Order("score desc, id desc").Limit(limit).Find(&hits).Error
+		if err == nil {
+			for i := range hits {
+				hits[i].Snippet = makeSnippet(hits[i].Content, q, SearchSnippetRadius)
+			}
+			return hits, nil
+		}
+		log.Printf("[Search] 聊天全文检索失败，改用LIKE: %v", err)
+		hits = nil
+	}
+	like := "%" + strings.NewReplacer("%", "\\%", "_", "\\_").Replace(q) + "%"
+	if err := db.GetDB().Model(&db.ChatRecord{}).Where("user_id = ? AND content LIKE ?", userID, like).
+		Order("id desc").Limit(limit).Find(&hits).Error; err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Score = 1
+		hits[i].Snippet = makeSnippet(hits[i].Content, q, SearchSnippetRadius)
+	}
+	return hits, nil
+}
+
+// SearchArticlesHandler 搜索文章
+func SearchArticlesHandler(c *gin.Context) {
+	q, limit, ok := parseSearchParams(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "q should be 2-64 characters and limit 1-50"})
+		return
+	}
+	hits, err := searchArticles(q, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"results": hits})
+}
+
+// SearchChatHandler 搜索自己的聊天记录
+func SearchChatHandler(c *gin.Context) {
+	openid := c.Query("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	q, limit, ok := parseSearchParams(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "q should be 2-64 characters and limit 1-50"})
+		return
+	}
+	var user db.User
+	if err := db.GetDB().Where("open_id = ?", openid).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	hits, err := searchChatRecords(user.ID, q, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"results": hits})
+}
@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// 测试搜索摘要截取
+func TestMakeSnippet(t *testing.T) {
+	text := "戒断初期常见的反应包括焦虑、失眠和注意力不集中。遇到冲动时，可以尝试离开当前环境，去户外散步或运动。坚持一段时间后，这些反应会逐渐减轻。"
+	snippet := makeSnippet(text, "户外散步", 10)
+	assert.Contains(t, snippet, "户外散步")
+	assert.True(t, len([]rune(snippet)) <= 22)
+	assert.Equal(t, "…", string([]rune(snippet)[0]))
+
+	// 完整关键词未命中时按分词定位
+	assert.Contains(t, makeSnippet(text, "失眠怎么办", 5), "失眠")
+	// 未命中时取开头
+	assert.Equal(t, "戒断初期常见…", makeSnippet(text, "股票", 3))
+}
+
+// 测试搜索参数校验
+func TestSearchInvalidParams(t *testing.T) {
+	router := setupTestRouter()
+	for _, url := range []string{
+		"/api/articles/search?q=戒",
+		"/api/articles/search?q=戒断&limit=100",
+		"/api/chat/search?q=戒断",
+		"/api/chat/search?openid=o1&q=",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 400, w.Code, url)
+	}
+}
+
+// 测试不使用全文索引时的内存检索排序
+func TestRankArticles(t *testing.T) {
+	articles := []db.Article{
+		{Title: "规律作息的重要性", Desc: "早睡早起", Body: "保持早睡早起，每天运动半小时，有助于稳定情绪。"},
+		{Title: "如何应对深夜的冲动", Desc: "深夜冲动", Body: "深夜独处时冲动最强，可以放下手机、离开卧室、做俯卧撑转移注意力。"},
+		{Title: "破戒后如何调整心态", Desc: "重新开始", Body: "破戒不代表失败，记录诱因，冲动过后重新开始打卡。"},
+	}
+	for i := range articles {
+		articles[i].ID = uint(i + 1)
+	}
+
+	hits := rankArticles(articles, "深夜冲动", 10)
+	assert.Len(t, hits, 3)
+	assert.Equal(t, uint(2), hits[0].ID)
+	assert.Equal(t, uint(3), hits[1].ID)
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+	assert.Greater(t, hits[1].Score, hits[2].Score)
+	assert.Contains(t, hits[0].Snippet, "冲动")
+	assert.Empty(t, hits[0].Body)
+
+	assert.Len(t, rankArticles(articles, "深夜冲动", 1), 1)
+	assert.Empty(t, rankArticles(articles, "股票基金", 10))
+	assert.Empty(t, rankArticles(nil, "冲动", 10))
+}
@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"jieyou-backend/internal/db"
+)
+
+// SignStats 用户打卡统计
+type SignStats struct {
+	TotalSign     int    `json:"total_sign"`
+	TotalBreak    int    `json:"total_break"`
+	CurrentStreak int    `json:"current_streak"`
+	BestStreak    int    `json:"best_streak"`
+	LastBreakDate string `json:"last_break_date"` // yyyy-mm-dd，从未破戒为空
+}
+
+// computeSignStats 统计打卡记录，records 需按日期升序
+func computeSignStats(records []db.SignRecord) SignStats {
+	var stats SignStats
+	lastDate := ""
+	streak := 0
+	for _, r := range records {
+		if r.Type == "break" {
+			stats.TotalBreak++
+			streak = 0
+			lastDate = r.Date
+			stats.LastBreakDate = r.Date
+			continue
+		}
+		if r.Type == "sign" {
+			stats.TotalSign++
+			if lastDate == "" || nextDay(lastDate) == r.Date {
+				streak++
+			} else {
+				streak = 1
+			}
+			lastDate = r.Date
+			stats.BestStreak = max(stats.BestStreak, streak)
+		}
+	}
+	stats.CurrentStreak = streak
+	return stats
+}
+
+// loadSignStats 查询用户全部打卡记录并统计
+func loadSignStats(userID uint) ([]db.SignRecord, SignStats) {
+	var records []db.SignRecord
+	db.GetDB().Where("user_id = ?", userID).Order("date asc").Find(&records)
+	return records, computeSignStats(records)
+}
@@ -0,0 +1,212 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"jieyou-backend/internal/common"
+)
+
+// Storage 媒体文件存储
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// localStorage 本地磁盘存储，由 gin 静态路由对外提供访问
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+func (s *localStorage) Name() string {
+	return "local"
+}
+
+func (s *localStorage) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return path, nil
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *localStorage) URL(key string) string {
+	return strings.TrimRight(s.baseURL, "/") + "/" + key
+}
+
+// s3Storage S3 兼容对象存储，使用 path-style 地址和 AWS Signature V4 签名
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+func (s *s3Storage) Name() string {
+	return "s3"
+}
+
+func (s *s3Storage) objectURL(key string) string {
+	return strings.TrimRight(s.endpoint, "/") + "/" + s.bucket + "/" + key
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return s.do(req, data)
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, nil)
+}
+
+func (s *s3Storage) URL(key string) string {
+	if s.publicURL != "" {
+		return strings.TrimRight(s.publicURL, "/") + "/" + key
+	}
+	return s.objectURL(key)
+}
+
+func (s *s3Storage) do(req *http.Request, payload []byte) error {
+	s.sign(req, payload, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 %s %s: status %d: %s", req.Method, req.URL.Path, resp.StatusCode, body)
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sigV4SigningKey 派生 Signature V4 签名密钥
+func sigV4SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// sign 按 AWS Signature V4 为请求添加签名头，签名 host、x-amz-content-sha256、x-amz-date
+func (s *s3Storage) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(sigV4SigningKey(s.secretKey, date, s.region, "s3"), stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+var (
+	storageOnce sync.Once
+	storage     Storage
+)
+
+// newStorage 按配置创建存储
+func newStorage() Storage {
+	if common.StorageBackend == "s3" {
+		return &s3Storage{
+			endpoint:  common.S3Endpoint,
+			region:    common.S3Region,
+			bucket:    common.S3Bucket,
+			accessKey: common.S3AccessKey,
+			secretKey: common.S3SecretKey,
+			publicURL: common.S3PublicURL,
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return &localStorage{dir: common.LocalStorageDir, baseURL: common.LocalStorageURL}
+}
+
+func getStorage() Storage {
+	storageOnce.Do(func() {
+		if storage == nil {
+			storage = newStorage()
+		}
+	})
+	return storage
+}
+
+// SetStorage 替换全局存储，用于测试
+func SetStorage(s Storage) {
+	storageOnce.Do(func() {})
+	storage = s
+}
@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// wx.requestSubscribeMessage 返回的模板订阅状态
+const (
+	SubscribeAccept = "accept" // 同意，增加一次发送次数
+	SubscribeReject = "reject" // 拒绝
+	SubscribeBan    = "ban"    // 已被后台封禁，已有次数不可用
+	SubscribeFilter = "filter" // 模板因标题同名被后台过滤
+)
+
+var subscribeStatuses = map[string]bool{
+	SubscribeAccept: true,
+	SubscribeReject: true,
+	SubscribeBan:    true,
+	SubscribeFilter: true,
+}
+
+// subscriptionTemplateIDs 小程序可订阅的消息模板
+func subscriptionTemplateIDs() []string {
+	var ids []string
+	for _, tpl := range enabledNotifyTemplates() {
+		ids = append(ids, tpl.TemplateID)
+	}
+	return ids
+}
+
+func isSubscriptionTemplate(templateID string) bool {
+	for _, id := range subscriptionTemplateIDs() {
+		if id == templateID {
+			return true
+		}
+	}
+	return false
+}
+
+// grantSubscriptionCredits 记录用户对各模板的订阅选择：accept 加一次发送次数，ban 清空次数
+func grantSubscriptionCredits(userID uint, results map[string]string) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		for templateID, status := range results {
+			credit := db.SubscriptionCredit{UserID: userID, TemplateID: templateID, Status: status}
+			updates := map[string]any{"status": status, "updated_at": time.Now()}
+			switch status {
+			case SubscribeAccept:
+				credit.Credits = 1
+				updates["credits"] = gorm.Expr("credits + 1")
+			case SubscribeBan:
+				updates["credits"] = 0
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "template_id"}},
+				DoUpdates: clause.Assignments(updates),
+			}).Create(&credit).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// consumeSubscriptionCredit 扣减一次发送次数，没有剩余次数时返回 false
+func consumeSubscriptionCredit(tx *gorm.DB, userID uint, templateID string) (bool, error) {
+	result := tx.Model(&db.SubscriptionCredit{}).
+		Where("user_id = ? AND template_id = ? AND credits > 0", userID, templateID).
+		UpdateColumn("credits", gorm.Expr("credits - 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// settleSubscriptionCredit 发送失败后处理已扣减的次数
+// 微信返回用户拒收（次数已用完）时清空次数；其他原因发送失败时微信不扣次数，退回本次扣减
+func settleSubscriptionCredit(tx *gorm.DB, userID uint, templateID string, sendErr error) error {
+	query := tx.Model(&db.SubscriptionCredit{}).Where("user_id = ? AND template_id = ?", userID, templateID)
+	if classifyNotifyError(sendErr) == NotifyOutcomeRefused {
+		return query.UpdateColumn("credits", 0).Error
+	}
+	return query.UpdateColumn("credits", gorm.Expr("credits + 1")).Error
+}
+
+// SubscriptionCreditInfo 模板剩余发送次数
+type SubscriptionCreditInfo struct {
+	Credits int    `json:"credits"`
+	Status  string `json:"status"`
+}
+
+// loadSubscriptionCredits 用户各模板的剩余次数，未授权过的模板次数为0
+func loadSubscriptionCredits(userID uint) map[string]SubscriptionCreditInfo {
+	out := map[string]SubscriptionCreditInfo{}
+	for _, id := range subscriptionTemplateIDs() {
+		out[id] = SubscriptionCreditInfo{}
+	}
+	var credits []db.SubscriptionCredit
+	db.GetDB().Where("user_id = ?", userID).Find(&credits)
+	for _, c := range credits {
+		if _, ok := out[c.TemplateID]; ok {
+			out[c.TemplateID] = SubscriptionCreditInfo{Credits: c.Credits, Status: c.Status}
+		}
+	}
+	return out
+}
+
+// hasSubscriptionCredit 用户是否还能收到该模板的消息
+func hasSubscriptionCredit(userID uint, templateID string) bool {
+	var count int64
+	db.GetDB().Model(&db.SubscriptionCredit{}).
+		Where("user_id = ? AND template_id = ? AND credits > 0", userID, templateID).Count(&count)
+	return count > 0
+}
+
+// MigrateSubscriptionCredits 将旧的 is_auth 授权转换为默认模板的一次发送次数
+func MigrateSubscriptionCredits() {
+	var subs []db.Subscription
+	db.GetDB().Where("is_auth = ?", true).Find(&subs)
+	for _, sub := range subs {
+		err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.SubscriptionCredit{
+				UserID: sub.UserID, TemplateID: common.WxTemplateID, Credits: 1, Status: SubscribeAccept,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&db.Subscription{}).Where("id = ?", sub.ID).Update("is_auth", false).Error
+		})
+		if err != nil {
+			log.Printf("迁移用户 %d 的订阅授权失败: %v", sub.UserID, err)
+		}
+	}
+	if len(subs) > 0 {
+		log.Printf("已迁移 %d 个旧订阅授权", len(subs))
+	}
+}
+
+// SubscriptionCreditsHandler 查询各模板剩余的订阅消息次数，参数 openid
+// need_prompt 为 true 时小程序应在用户下次点击时再次请求订阅
+func SubscriptionCreditsHandler(c *gin.Context) {
+	openid := c.Query("openid")
+	if openid == "" {
+		c.JSON(400, gin.H{"error": "openid required"})
+		return
+	}
+	userID := lookupUserID(openid)
+	if userID == 0 {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return
+	}
+	credits := loadSubscriptionCredits(userID)
+	needPrompt := false
+	for _, info := range credits {
+		if info.Credits == 0 && info.Status != SubscribeBan {
+			needPrompt = true
+		}
+	}
+	c.JSON(200, gin.H{"credits": credits, "need_prompt": needPrompt})
+}
@@ -0,0 +1,165 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 工具权限级别
+const (
+	ToolPermRead  = "read"  // 只读取用户数据
+	ToolPermWrite = "write" // 代用户写入数据
+)
+
+// ToolContext 工具执行时的调用方信息
+type ToolContext struct {
+	User     *db.User
+	ReadOnly bool // 只读模式（如离线评估）下禁止写操作类工具
+}
+
+// Tool 可供大模型调用的服务端工具
+type Tool struct {
+	Definition LLMToolDefinition
+	Permission string
+	// Allow 工具级别的额外权限检查，可为nil
+	Allow   func(ctx context.Context, tc *ToolContext) error
+	Handler func(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error)
+}
+
+// ToolRegistry 工具注册表
+type ToolRegistry struct {
+	tools map[string]*Tool
+	order []string
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: map[string]*Tool{}}
+}
+
+// Register 注册工具，同名覆盖
+func (r *ToolRegistry) Register(t *Tool) {
+	if _, ok := r.tools[t.Definition.Name]; !ok {
+		r.order = append(r.order, t.Definition.Name)
+	}
+	r.tools[t.Definition.Name] = t
+}
+
+// Definitions 返回提供给大模型的工具定义
+func (r *ToolRegistry) Definitions() []LLMToolDefinition {
+	var defs []LLMToolDefinition
+	for _, name := range r.order {
+		defs = append(defs, r.tools[name].Definition)
+	}
+	return defs
+}
+
+// checkPermission 检查当前调用方是否可以使用该工具
+func (r *ToolRegistry) checkPermission(ctx context.Context, t *Tool, tc *ToolContext) error {
+	if tc == nil || tc.User == nil || tc.User.ID == 0 {
+		return errors.New("未识别的用户")
+	}
+	if t.Permission == ToolPermWrite && tc.ReadOnly {
+		return errors.New("当前会话不允许执行写操作")
+	}
+	if t.Allow != nil {
+		return t.Allow(ctx, tc)
+	}
+	return nil
+}
+
+// Call 执行一次工具调用，结果（或错误）序列化为JSON返回给大模型
+func (r *ToolRegistry) Call(ctx context.Context, tc *ToolContext, call LLMToolCall) string {
+	result, err := r.call(ctx, tc, call)
+	if err != nil {
+		log.Printf("[Tool] %s 调用失败: %v", call.Name, err)
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(b)
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return `{"error":"工具结果序列化失败"}`
+	}
+	return string(b)
+}
+
+func (r *ToolRegistry) call(ctx context.Context, tc *ToolContext, call LLMToolCall) (any, error) {
+	t, ok := r.tools[call.Name]
+	if !ok {
+		return nil, fmt.Errorf("工具 %s 不存在", call.Name)
+	}
+	if err := r.checkPermission(ctx, t, tc); err != nil {
+		return nil, err
+	}
+	args := json.RawMessage(call.Arguments)
+	if strings.TrimSpace(call.Arguments) == "" {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return nil, errors.New("参数不是合法的JSON")
+	}
+	return t.Handler(ctx, tc, args)
+}
+
+// runToolLoop 带工具调用的对话循环：模型请求工具时在服务端执行并回传结果，直到模型给出最终回复
+// 超过 AIMaxToolRounds 轮后不再提供工具，强制模型直接回答
+func runToolLoop(ctx context.Context, p LLMProvider, req LLMRequest, registry *ToolRegistry, tc *ToolContext, onDelta func(string)) (*LLMResult, error) {
+	if registry == nil || len(registry.order) == 0 {
+		return p.Chat(ctx, req, onDelta)
+	}
+	req.Tools = registry.Definitions()
+	req.Messages = append([]LLMMessage(nil), req.Messages...)
+	for round := 0; ; round++ {
+		if round >= common.AIMaxToolRounds {
+			req.Tools = nil
+		}
+		res, err := p.Chat(ctx, req, onDelta)
+		if err != nil {
+			return res, err
+		}
+		if len(res.ToolCalls) == 0 || req.Tools == nil {
+			return res, nil
+		}
+		req.Messages = append(req.Messages, LLMMessage{Role: "assistant", Content: res.Content, ToolCalls: res.ToolCalls})
+		for i, call := range res.ToolCalls {
+			if call.ID == "" {
+				call.ID = fmt.Sprintf("call_%d_%d", round, i)
+				res.ToolCalls[i].ID = call.ID
+			}
+			req.Messages = append(req.Messages, LLMMessage{
+				Role:       "tool",
+				Name:       call.Name,
+				ToolCallID: call.ID,
+				Content:    registry.Call(ctx, tc, call),
+			})
+		}
+	}
+}
+
+// chatTools 对话中可用的工具，按 AI_TOOLS 配置过滤
+var chatTools = newChatToolRegistry(common.AITools)
+
+func newChatToolRegistry(enabled string) *ToolRegistry {
+	registry := NewToolRegistry()
+	if enabled == "none" {
+		return registry
+	}
+	allow := map[string]bool{}
+	for _, name := range strings.Split(enabled, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allow[name] = true
+		}
+	}
+	for _, t := range builtinTools() {
+		if len(allow) == 0 || allow[t.Definition.Name] {
+			registry.Register(t)
+		}
+	}
+	return registry
+}
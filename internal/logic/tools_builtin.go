@@ -0,0 +1,189 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// 预约提醒限制
+const (
+	MaxPendingReminders   = 3 // 每个用户最多同时存在的待发送提醒
+	MaxReminderAheadDays  = 7 // 最多预约N天内的提醒
+	MaxReminderNoteLength = 20
+)
+
+// builtinTools 内置的对话工具
+func builtinTools() []*Tool {
+	return []*Tool{
+		{
+			Definition: LLMToolDefinition{
+				Name:        "get_calendar_stats",
+				Description: "查询当前用户的打卡统计：当前连续守戒天数、最长连续天数、累计打卡/破戒次数、最近破戒日期及规律",
+				Parameters:  map[string]any{"type": "object", "properties": map[string]any{}},
+			},
+			Permission: ToolPermRead,
+			Handler:    getCalendarStatsTool,
+		},
+		{
+			Definition: LLMToolDefinition{
+				Name:        "recommend_articles",
+				Description: "根据关键词从戒瘾资讯文章库中推荐相关文章",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"keyword": map[string]any{"type": "string", "description": "关键词，如 冲动、失眠、焦虑"},
+						"limit":   map[string]any{"type": "integer", "description": "返回文章数，1-5", "minimum": 1, "maximum": 5},
+					},
+				},
+			},
+			Permission: ToolPermRead,
+			Handler:    recommendArticlesTool,
+		},
+		{
+			Definition: LLMToolDefinition{
+				Name:        "schedule_reminder",
+				Description: "为用户预约一次微信提醒，仅在用户明确要求时使用",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"remind_at": map[string]any{"type": "string", "description": "提醒时间，格式 yyyy-mm-dd HH:MM"},
+						"note":      map[string]any{"type": "string", "description": "提醒内容，不超过20字"},
+					},
+					"required": []string{"remind_at"},
+				},
+			},
+			Permission: ToolPermWrite,
+			Allow:      requireSubscription,
+			Handler:    scheduleReminderTool,
+		},
+		{
+			Definition: LLMToolDefinition{
+				Name:        "log_urge",
+				Description: "记录用户当前的一次冲动，包括强度和诱因，仅在用户描述了正在经历的冲动时使用",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"intensity": map[string]any{"type": "integer", "description": "冲动强度 1-10", "minimum": 1, "maximum": 10},
+						"trigger":   map[string]any{"type": "string", "description": "诱因，如 深夜刷手机、压力大"},
+						"note":      map[string]any{"type": "string", "description": "补充说明"},
+					},
+					"required": []string{"intensity"},
+				},
+			},
+			Permission: ToolPermWrite,
+			Handler:    logUrgeTool,
+		},
+	}
+}
+
+func getCalendarStatsTool(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+	records, _ := loadSignStats(tc.User.ID)
+	snap := buildRecoverySnapshot(records, time.Now())
+	return map[string]any{
+		"current_streak": snap.CurrentStreak,
+		"best_streak":    snap.BestStreak,
+		"total_sign":     snap.TotalSign,
+		"total_break":    snap.TotalBreak,
+		"recent_breaks":  snap.RecentBreaks,
+		"peak_weekdays":  snap.PeakWeekdays,
+		"peak_time":      snap.PeakTimeOfDay,
+	}, nil
+}
+
+func recommendArticlesTool(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+	var req struct {
+		Keyword string `json:"keyword"`
+		Limit   int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, errors.New("参数格式错误")
+	}
+	if req.Limit <= 0 || req.Limit > 5 {
+		req.Limit = 3
+	}
+	query := db.GetDB().Model(&db.Article{}).Where("status = ?", db.ArticleStatusPublished)
+	if req.Keyword != "" {
+		like := "%" + req.Keyword + "%"
+		query = query.Where("title LIKE ? OR `desc` LIKE ?", like, like)
+	}
+	type articleBrief struct {
+		ID    uint   `json:"id"`
+		Title string `json:"title"`
+		Desc  string `json:"desc"`
+	}
+	var articles []articleBrief
+	if err := query.Order("read_count desc").Limit(req.Limit).Find(&articles).Error; err != nil {
+		return nil, errors.New("查询文章失败")
+	}
+	return map[string]any{"articles": articles}, nil
+}
+
+// requireSubscription 预约提醒需要用户有剩余的订阅消息次数
+func requireSubscription(ctx context.Context, tc *ToolContext) error {
+	if !hasSubscriptionCredit(tc.User.ID, common.WxTemplateID) {
+		return errors.New("用户未授权订阅消息，请引导用户在小程序中开启提醒")
+	}
+	return nil
+}
+
+func scheduleReminderTool(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+	var req struct {
+		RemindAt string `json:"remind_at"`
+		Note     string `json:"note"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, errors.New("参数格式错误")
+	}
+	remindAt, err := time.ParseInLocation("2006-01-02 15:04", req.RemindAt, time.Local)
+	if err != nil {
+		return nil, errors.New("remind_at 格式应为 yyyy-mm-dd HH:MM")
+	}
+	now := time.Now()
+	if !remindAt.After(now) || remindAt.After(now.AddDate(0, 0, MaxReminderAheadDays)) {
+		return nil, errors.New("只能预约未来7天内的提醒")
+	}
+	if req.Note == "" {
+		req.Note = "该打卡啦"
+	}
+	if utf8.RuneCountInString(req.Note) > MaxReminderNoteLength {
+		req.Note = string([]rune(req.Note)[:MaxReminderNoteLength])
+	}
+	var pending int64
+	db.GetDB().Model(&db.UserReminder{}).Where("user_id = ? AND status = ?", tc.User.ID, "pending").Count(&pending)
+	if pending >= MaxPendingReminders {
+		return nil, errors.New("待发送的提醒已达上限")
+	}
+	reminder := db.UserReminder{UserID: tc.User.ID, RemindAt: remindAt, Note: req.Note, Status: "pending"}
+	if err := db.GetDB().Create(&reminder).Error; err != nil {
+		return nil, errors.New("保存提醒失败")
+	}
+	return map[string]any{"reminder_id": reminder.ID, "remind_at": remindAt.Format("2006-01-02 15:04")}, nil
+}
+
+func logUrgeTool(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+	var req struct {
+		Intensity int    `json:"intensity"`
+		Trigger   string `json:"trigger"`
+		Note      string `json:"note"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, errors.New("参数格式错误")
+	}
+	if req.Intensity < 1 || req.Intensity > 10 {
+		return nil, errors.New("intensity 应为 1-10")
+	}
+	if utf8.RuneCountInString(req.Trigger) > 128 || utf8.RuneCountInString(req.Note) > 256 {
+		return nil, errors.New("trigger 或 note 过长")
+	}
+	urge := db.UrgeLog{UserID: tc.User.ID, Intensity: req.Intensity, Trigger: req.Trigger, Note: req.Note, Source: "ai"}
+	if err := db.GetDB().Create(&urge).Error; err != nil {
+		return nil, errors.New("保存记录失败")
+	}
+	return map[string]any{"urge_id": urge.ID}, nil
+}
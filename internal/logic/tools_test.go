@@ -0,0 +1,102 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/db"
+)
+
+// newTestToolRegistry 不依赖数据库的测试工具
+func newTestToolRegistry(writes *int) *ToolRegistry {
+	registry := NewToolRegistry()
+	registry.Register(&Tool{
+		Definition: LLMToolDefinition{Name: "echo", Parameters: map[string]any{"type": "object"}},
+		Permission: ToolPermRead,
+		Handler: func(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+			var v map[string]any
+			json.Unmarshal(args, &v)
+			return map[string]any{"echo": v["text"], "user_id": tc.User.ID}, nil
+		},
+	})
+	registry.Register(&Tool{
+		Definition: LLMToolDefinition{Name: "write", Parameters: map[string]any{"type": "object"}},
+		Permission: ToolPermWrite,
+		Handler: func(ctx context.Context, tc *ToolContext, args json.RawMessage) (any, error) {
+			*writes++
+			return map[string]any{"ok": true}, nil
+		},
+	})
+	return registry
+}
+
+// 测试工具调用循环：执行工具后把结果回传给模型
+func TestRunToolLoop(t *testing.T) {
+	writes := 0
+	provider := &ScriptedProvider{Steps: []LLMResult{
+		{ToolCalls: []LLMToolCall{{ID: "c1", Name: "echo", Arguments: `{"text":"hi"}`}}},
+		{Content: "已为你查询"},
+	}}
+	user := &db.User{ID: 7}
+
+	res, err := runToolLoop(context.Background(), provider, LLMRequest{Messages: []LLMMessage{{Role: "user", Content: "查一下"}}},
+		newTestToolRegistry(&writes), &ToolContext{User: user}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "已为你查询", res.Content)
+
+	reqs := provider.Requests()
+	assert.Len(t, reqs, 2)
+	assert.Len(t, reqs[0].Tools, 2)
+	last := reqs[1].Messages[len(reqs[1].Messages)-1]
+	assert.Equal(t, "tool", last.Role)
+	assert.Equal(t, "c1", last.ToolCallID)
+	assert.JSONEq(t, `{"echo":"hi","user_id":7}`, last.Content)
+}
+
+// 测试只读模式下写操作工具被拒绝，未知工具返回错误
+func TestToolPermission(t *testing.T) {
+	writes := 0
+	registry := newTestToolRegistry(&writes)
+	tc := &ToolContext{User: &db.User{ID: 1}, ReadOnly: true}
+
+	out := registry.Call(context.Background(), tc, LLMToolCall{Name: "write"})
+	assert.Contains(t, out, "error")
+	assert.Equal(t, 0, writes)
+
+	out = registry.Call(context.Background(), tc, LLMToolCall{Name: "missing"})
+	assert.Contains(t, out, "error")
+
+	out = registry.Call(context.Background(), &ToolContext{}, LLMToolCall{Name: "echo"})
+	assert.Contains(t, out, "error")
+
+	tc.ReadOnly = false
+	out = registry.Call(context.Background(), tc, LLMToolCall{Name: "write"})
+	assert.JSONEq(t, `{"ok":true}`, out)
+	assert.Equal(t, 1, writes)
+}
+
+// 测试超过最大轮数后不再提供工具
+func TestRunToolLoopMaxRounds(t *testing.T) {
+	writes := 0
+	provider := &ScriptedProvider{Respond: func(req LLMRequest) (*LLMResult, error) {
+		if len(req.Tools) == 0 {
+			return &LLMResult{Content: "最终回复"}, nil
+		}
+		return &LLMResult{ToolCalls: []LLMToolCall{{Name: "echo", Arguments: "{}"}}}, nil
+	}}
+	res, err := runToolLoop(context.Background(), provider, LLMRequest{}, newTestToolRegistry(&writes), &ToolContext{User: &db.User{ID: 1}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "最终回复", res.Content)
+	assert.Len(t, provider.Requests(), 4)
+}
+
+// 测试按配置过滤内置工具
+func TestNewChatToolRegistry(t *testing.T) {
+	assert.Len(t, newChatToolRegistry("").Definitions(), 4)
+	assert.Empty(t, newChatToolRegistry("none").Definitions())
+	defs := newChatToolRegistry("log_urge, get_calendar_stats").Definitions()
+	assert.Len(t, defs, 2)
+}
@@ -0,0 +1,199 @@
+package logic
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// usageMeta 记录用量时需要的调用方信息，通过context传入LLMRouter
+type usageMeta struct {
+	UserID         uint
+	ConversationID string
+	Scene          string
+}
+
+type usageMetaKey struct{}
+
+// withUsageMeta 在context中附带用户和会话信息
+func withUsageMeta(ctx context.Context, userID uint, conversationID, scene string) context.Context {
+	return context.WithValue(ctx, usageMetaKey{}, usageMeta{UserID: userID, ConversationID: conversationID, Scene: scene})
+}
+
+// estimateTokens 服务端未返回用量时按字符数粗略估算（中文约1字1token）
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// estimateLLMCost 按价格表计算费用（元），未配置价格的模型记为0
+func estimateLLMCost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := common.AIPriceTable[model]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1000
+}
+
+// recordLLMUsage 记录一次模型调用，作为LLMRouter.OnCall使用
+func recordLLMUsage(ctx context.Context, p LLMProvider, req LLMRequest, res *LLMResult, err error, latency time.Duration) {
+	if db.GetDB() == nil {
+		return
+	}
+	meta, _ := ctx.Value(usageMetaKey{}).(usageMeta)
+	usage := db.LLMUsage{
+		UserID:         meta.UserID,
+		ConversationID: meta.ConversationID,
+		Scene:          meta.Scene,
+		Provider:       p.Name(),
+		Model:          p.Model(),
+		LatencyMs:      latency.Milliseconds(),
+		Outcome:        "success",
+	}
+	if err != nil {
+		usage.Outcome = toAIError(err).Code
+	}
+	if res != nil {
+		usage.PromptTokens = res.PromptTokens
+		usage.CompletionTokens = res.CompletionTokens
+		if usage.PromptTokens == 0 && usage.CompletionTokens == 0 && res.Content != "" {
+			for _, m := range req.Messages {
+				usage.PromptTokens += estimateTokens(m.Content)
+			}
+			usage.CompletionTokens = estimateTokens(res.Content)
+			usage.Estimated = true
+		}
+	}
+	usage.Cost = estimateLLMCost(usage.Model, usage.PromptTokens, usage.CompletionTokens)
+	if err := db.GetDB().Create(&usage).Error; err != nil {
+		log.Printf("[LLMUsage] 记录用量失败: %v", err)
+	}
+}
+
+// usageDateRange 解析 from/to 查询参数（yyyy-mm-dd），默认最近30天
+func usageDateRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -29)
+	to := from.AddDate(0, 0, 30)
+	if v := c.Query("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			return from, to, false
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			return from, to, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	return from, to, true
+}
+
+// UsageAggregate 用量汇总
+type UsageAggregate struct {
+	Period           string  `json:"period"`
+	Calls            int64   `json:"calls"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+const usageAggregateColumns = `COUNT(*) as calls,
+	  SUM(CASE WHEN outcome <> 'success' THEN 1 ELSE 0 END) as errors,
+	  COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+	  COALESCE(SUM(completion_tokens), 0) as completion_tokens,
+	  COALESCE(SUM(cost), 0) as cost`
+
+// DailyUsageHandler 按天汇总用量
+func DailyUsageHandler(c *gin.Context) {
+	from, to, ok := usageDateRange(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid date format, should be yyyy-mm-dd"})
+		return
+	}
+	var results []UsageAggregate
+	if err := db.GetDB().Raw(`
+	SELECT DATE_FORMAT(created_at, '%Y-%m-%d') as period, `+usageAggregateColumns+`
+	FROM llm_usage
+	WHERE created_at >= ? AND created_at < ?
+	GROUP BY period
+	ORDER BY period ASC
+	`, from, to).Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"daily": results})
+}
+
+// MonthlyUsageHandler 按月汇总用量，默认最近12个月
+func MonthlyUsageHandler(c *gin.Context) {
+	months, err := strconv.Atoi(c.DefaultQuery("months", "12"))
+	if err != nil || months <= 0 {
+		c.JSON(400, gin.H{"error": "invalid months"})
+		return
+	}
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -(months - 1), 0)
+	var results []UsageAggregate
+	if err := db.GetDB().Raw(`
+	SELECT DATE_FORMAT(created_at, '%Y-%m') as period, `+usageAggregateColumns+`
+	FROM llm_usage
+	WHERE created_at >= ?
+	GROUP BY period
+	ORDER BY period ASC
+	`, from).Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"monthly": results})
+}
+
+// TopUsageUsersHandler 时间范围内消耗最多的用户
+func TopUsageUsersHandler(c *gin.Context) {
+	from, to, ok := usageDateRange(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "invalid date format, should be yyyy-mm-dd"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(400, gin.H{"error": "limit should be 1-100"})
+		return
+	}
+	type Result struct {
+		UserID           uint    `json:"user_id"`
+		Nickname         string  `json:"nickname"`
+		Calls            int64   `json:"calls"`
+		PromptTokens     int64   `json:"prompt_tokens"`
+		CompletionTokens int64   `json:"completion_tokens"`
+		Cost             float64 `json:"cost"`
+	}
+	var results []Result
+	if err := db.GetDB().Raw(`
+	SELECT l.user_id, u.nickname,
+	  COUNT(*) as calls,
+	  COALESCE(SUM(l.prompt_tokens), 0) as prompt_tokens,
+	  COALESCE(SUM(l.completion_tokens), 0) as completion_tokens,
+	  COALESCE(SUM(l.cost), 0) as cost
+	FROM llm_usage l
+	LEFT JOIN users u ON u.id = l.user_id
+	WHERE l.created_at >= ? AND l.created_at < ?
+	GROUP BY l.user_id, u.nickname
+	ORDER BY cost DESC, prompt_tokens + completion_tokens DESC
+	LIMIT ?
+	`, from, to, limit).Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(200, gin.H{"users": results})
+}
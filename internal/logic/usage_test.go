@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jieyou-backend/internal/common"
+)
+
+// 测试按价格表估算费用
+func TestEstimateLLMCost(t *testing.T) {
+	common.AIPriceTable["test-model"] = common.ModelPrice{Input: 1, Output: 2}
+	defer delete(common.AIPriceTable, "test-model")
+
+	assert.InDelta(t, 0.5, estimateLLMCost("test-model", 100, 200), 1e-9)
+	assert.Equal(t, 0.0, estimateLLMCost("unknown-model", 100, 200))
+}
+
+// 测试管理接口鉴权
+func TestAdminAuth(t *testing.T) {
+	router := setupTestRouter()
+
+	// 未配置ADMIN_TOKEN时管理接口不可用
+	common.AdminToken = ""
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/admin/llm_usage/daily", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+
+	common.AdminToken = "secret"
+	defer func() { common.AdminToken = "" }()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/llm_usage/daily", nil)
+	req.Header.Set("X-Admin-Token", "wrong")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+}
@@ -0,0 +1,267 @@
+package logic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+const (
+	wxTokenRefreshAhead = 5 * time.Minute  // 提前刷新，避免发送途中过期
+	wxTokenLockTTL      = 30 * time.Second // 刷新锁的持有时长，持有者崩溃后其他实例可抢占
+	wxTokenPollInterval = 200 * time.Millisecond
+)
+
+// wxToken access token 及过期时间
+type wxToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+func (t wxToken) valid(now time.Time) bool {
+	return t.AccessToken != "" && now.Add(wxTokenRefreshAhead).Before(t.ExpiresAt)
+}
+
+// wxTokenStore access token 的共享存储及刷新锁，可替换为 Redis 等实现
+type wxTokenStore interface {
+	Load() (wxToken, error)
+	Save(t wxToken) error
+	// Lock 获取刷新锁，已被其他持有者占用且未过期时返回 false
+	Lock(owner string, ttl time.Duration) (bool, error)
+	Unlock(owner string) error
+}
+
+// memoryTokenStore 单实例使用，进程内的合并刷新已足够，锁总是成功
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	token wxToken
+}
+
+func (s *memoryTokenStore) Load() (wxToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) Save(t wxToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = t
+	return nil
+}
+
+func (s *memoryTokenStore) Lock(string, time.Duration) (bool, error) { return true, nil }
+func (s *memoryTokenStore) Unlock(string) error                      { return nil }
+
+// dbTokenStore 多实例通过 wx_tokens 表共享 token，用条件更新实现刷新锁
+type dbTokenStore struct {
+	appID string
+}
+
+func (s *dbTokenStore) Load() (wxToken, error) {
+	var row db.WxToken
+	if err := db.GetDB().Where("app_id = ?", s.appID).Limit(1).Find(&row).Error; err != nil {
+		return wxToken{}, err
+	}
+	return wxToken{AccessToken: row.AccessToken, ExpiresAt: row.ExpiresAt}, nil
+}
+
+func (s *dbTokenStore) Save(t wxToken) error {
+	return db.GetDB().Model(&db.WxToken{}).Where("app_id = ?", s.appID).
+		Updates(map[string]any{"access_token": t.AccessToken, "expires_at": t.ExpiresAt}).Error
+}
+
+func (s *dbTokenStore) Lock(owner string, ttl time.Duration) (bool, error) {
+	if err := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&db.WxToken{AppID: s.appID}).Error; err != nil {
+		return false, err
+	}
+	now := time.Now()
+	until := now.Add(ttl)
+	result := db.GetDB().Model(&db.WxToken{}).
+		Where("app_id = ? AND (locked_until IS NULL OR locked_until < ? OR lock_owner = ?)", s.appID, now, owner).
+		Updates(map[string]any{"lock_owner": owner, "locked_until": until})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *dbTokenStore) Unlock(owner string) error {
+	return db.GetDB().Model(&db.WxToken{}).Where("app_id = ? AND lock_owner = ?", s.appID, owner).
+		Updates(map[string]any{"lock_owner": "", "locked_until": nil}).Error
+}
+
+// tokenRefreshCall 进行中的刷新，并发调用方等待同一次结果
+type tokenRefreshCall struct {
+	done  chan struct{}
+	token wxToken
+	err   error
+}
+
+// WxTokenManager 缓存微信 access token，并发刷新合并为一次，多实例通过共享存储加锁避免互相顶掉
+type WxTokenManager struct {
+	store wxTokenStore
+	owner string
+	fetch func() (wxToken, error)
+
+	mu    sync.Mutex
+	token wxToken
+	stale string // 微信返回已失效的 token，刷新时不能再用它
+	call  *tokenRefreshCall
+}
+
+func newWxTokenManager(store wxTokenStore) *WxTokenManager {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return &WxTokenManager{
+		store: store,
+		owner: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf)),
+		fetch: fetchWxAccessToken,
+	}
+}
+
+// Token 返回有效的 access token，过期或被标记失效时刷新
+func (m *WxTokenManager) Token() (string, error) {
+	m.mu.Lock()
+	if m.token.valid(time.Now()) {
+		token := m.token.AccessToken
+		m.mu.Unlock()
+		return token, nil
+	}
+	call := m.call
+	if call == nil {
+		call = &tokenRefreshCall{done: make(chan struct{})}
+		m.call = call
+		stale := m.stale
+		go func() {
+			call.token, call.err = m.refresh(stale)
+			m.mu.Lock()
+			if call.err == nil {
+				m.token, m.stale = call.token, ""
+			}
+			m.call = nil
+			m.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	m.mu.Unlock()
+	<-call.done
+	return call.token.AccessToken, call.err
+}
+
+// Invalidate 微信返回 40001/42001 等错误时调用，下次 Token 强制刷新；token 已被换掉时忽略
+func (m *WxTokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token.AccessToken == token {
+		m.token, m.stale = wxToken{}, token
+	}
+}
+
+// refresh 优先使用其他实例已写入共享存储的 token，否则抢锁后向微信获取
+func (m *WxTokenManager) refresh(stale string) (wxToken, error) {
+	usable := func() (wxToken, bool) {
+		t, err := m.store.Load()
+		return t, err == nil && t.valid(time.Now()) && t.AccessToken != stale
+	}
+	if t, ok := usable(); ok {
+		return t, nil
+	}
+	deadline := time.Now().Add(wxTokenLockTTL)
+	for {
+		locked, err := m.store.Lock(m.owner, wxTokenLockTTL)
+		if err != nil {
+			return wxToken{}, fmt.Errorf("获取access token刷新锁失败: %v", err)
+		}
+		if locked {
+			break
+		}
+		// 其他实例正在刷新，等待其写入
+		time.Sleep(wxTokenPollInterval)
+		if t, ok := usable(); ok {
+			return t, nil
+		}
+		if time.Now().After(deadline) {
+			return wxToken{}, errors.New("等待其他实例刷新access token超时")
+		}
+	}
+	defer m.store.Unlock(m.owner)
+	if t, ok := usable(); ok {
+		return t, nil
+	}
+	t, err := m.fetch()
+	if err != nil {
+		return wxToken{}, err
+	}
+	if err := m.store.Save(t); err != nil {
+		log.Printf("保存access token失败: %v", err)
+	}
+	log.Printf("获取新的access token成功，过期时间: %s", t.ExpiresAt.Format(time.DateTime))
+	return t, nil
+}
+
+// fetchWxAccessToken 向微信获取新的 access token
+func fetchWxAccessToken() (wxToken, error) {
+	u := fmt.Sprintf("%s/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s",
+		common.WxAPIBaseURL, url.QueryEscape(common.WxAPPID), url.QueryEscape(common.WxAPPSecret))
+	resp, err := wxHTTPClient.Get(u)
+	if err != nil {
+		return wxToken{}, fmt.Errorf("获取access token失败: %v", stripRequestURL(err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return wxToken{}, fmt.Errorf("读取响应失败: %v", err)
+	}
+	var tokenResp WxAccessTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return wxToken{}, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if tokenResp.ErrCode != 0 {
+		return wxToken{}, fmt.Errorf("微信API错误: %w", &WxAPIError{Code: tokenResp.ErrCode, Msg: tokenResp.ErrMsg})
+	}
+	return wxToken{
+		AccessToken: tokenResp.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+var wxHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	wxTokens     *WxTokenManager
+	wxTokensOnce sync.Once
+)
+
+func getWxTokenManager() *WxTokenManager {
+	wxTokensOnce.Do(func() {
+		if wxTokens != nil {
+			return
+		}
+		var store wxTokenStore = &memoryTokenStore{}
+		if common.WxTokenStore == "db" && db.GetDB() != nil {
+			store = &dbTokenStore{appID: common.WxAPPID}
+		}
+		wxTokens = newWxTokenManager(store)
+	})
+	return wxTokens
+}
+
+// SetWxTokenManager 替换全局 access token 管理器，用于测试
+func SetWxTokenManager(m *WxTokenManager) {
+	wxTokensOnce.Do(func() {})
+	wxTokens = m
+}
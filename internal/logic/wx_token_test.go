@@ -0,0 +1,121 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"jieyou-backend/internal/common"
+	"jieyou-backend/internal/db"
+)
+
+// fakeWxServer 模拟微信接口，sendErrCodes 依次作为发送订阅消息的返回码
+func fakeWxServer(t *testing.T, sendErrCodes ...int) (*httptest.Server, *int32, *[]string) {
+	var fetches int32
+	var usedTokens []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			n := atomic.AddInt32(&fetches, 1)
+			time.Sleep(20 * time.Millisecond)
+			json.NewEncoder(w).Encode(map[string]any{"access_token": fmt.Sprintf("token-%d", n), "expires_in": 7200})
+		case "/cgi-bin/message/subscribe/send":
+			mu.Lock()
+			usedTokens = append(usedTokens, r.URL.Query().Get("access_token"))
+			code := 0
+			if len(sendErrCodes) > 0 {
+				code, sendErrCodes = sendErrCodes[0], sendErrCodes[1:]
+			}
+			mu.Unlock()
+			json.NewEncoder(w).Encode(map[string]any{"errcode": code, "errmsg": "x", "msgid": 42})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	baseURL := common.WxAPIBaseURL
+	common.WxAPIBaseURL = srv.URL
+	SetWxTokenManager(newWxTokenManager(&memoryTokenStore{}))
+	t.Cleanup(func() {
+		srv.Close()
+		common.WxAPIBaseURL = baseURL
+		SetWxTokenManager(newWxTokenManager(&memoryTokenStore{}))
+	})
+	return srv, &fetches, &usedTokens
+}
+
+// 测试并发获取 access token 只刷新一次
+func TestWxTokenManagerSingleflight(t *testing.T) {
+	_, fetches, _ := fakeWxServer(t)
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = GetWxAccessToken()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(fetches))
+	for _, token := range tokens {
+		assert.Equal(t, "token-1", token)
+	}
+
+	// 标记失效后强制刷新，传入已被换掉的旧令牌不会再次刷新
+	getWxTokenManager().Invalidate("token-1")
+	token, err := GetWxAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	getWxTokenManager().Invalidate("token-1")
+	token, _ = GetWxAccessToken()
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+}
+
+// 测试令牌失效时刷新后重试发送
+func TestDeliverNotificationRefreshesToken(t *testing.T) {
+	_, fetches, used := fakeWxServer(t, WxErrInvalidCredential, 0)
+	err := deliverNotification(db.Notification{OpenID: "u1", Kind: NotifyCheckInReminder, TemplateID: "tpl"}, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, *used)
+	assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+
+	// 参数错误不重试
+	_, _, used = fakeWxServer(t, 47003)
+	err = deliverNotification(db.Notification{OpenID: "u1", Kind: NotifyCheckInReminder, TemplateID: "tpl"}, map[string]interface{}{})
+	assert.Equal(t, NotifyOutcomeFailed, classifyNotifyError(err))
+	assert.Len(t, *used, 1)
+}
+
+// 测试多实例共享存储时使用其他实例刷新的令牌
+func TestWxTokenManagerSharedStore(t *testing.T) {
+	_, fetches, _ := fakeWxServer(t)
+	store := &memoryTokenStore{}
+	a, b := newWxTokenManager(store), newWxTokenManager(store)
+
+	token, err := a.Token()
+	require.NoError(t, err)
+	token2, err := b.Token()
+	require.NoError(t, err)
+	assert.Equal(t, token, token2)
+	assert.Equal(t, int32(1), atomic.LoadInt32(fetches))
+
+	// a 刷新后 b 发现旧令牌失效，直接使用共享存储中的新令牌
+	a.Invalidate(token)
+	fresh, err := a.Token()
+	require.NoError(t, err)
+	b.Invalidate(token)
+	got, err := b.Token()
+	require.NoError(t, err)
+	assert.Equal(t, fresh, got)
+	assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+}
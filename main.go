@@ -1,17 +1,58 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"jieyou-backend/internal/db"
 	"jieyou-backend/internal/logic"
 )
 
 func main() {
+	// 离线评估提示词：go run . eval --suite eval/counselor.yaml
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(logic.RunEvalCommand(os.Args[2:]))
+	}
+
 	db.InitDB()
 
+	// 导入文章草稿：go run . import --feed <url> 或 go run . import --dir ./drafts
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(logic.RunImportCommand(os.Args[2:]))
+	}
+
+	// 将旧的订阅授权迁移为发送次数
+	logic.MigrateSubscriptionCredits()
+
+	// 加载文章检索索引
+	logic.StartArticleIndexer()
+
 	// 启动定时任务调度器
 	logic.StartScheduler()
 
 	// 启动Gin路由
 	router := logic.SetupRouter()
-	router.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("启动服务失败: %v", err)
+		}
+	}()
+
+	// 收到退出信号后停止接收请求，并写入缓冲中的阅读量
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("关闭服务失败: %v", err)
+	}
+	logic.FlushArticleReadCounts()
 }